@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// attrRule is a line of a .gitattributes file: a pattern and the attributes
+// it sets to true or false
+type attrRule struct {
+	Pattern string
+	Attrs   map[string]bool
+}
+
+// parseGitattributes parses the contents of a .gitattributes file
+// Attributes set to values other than true and false, and macros, are
+// ignored
+func parseGitattributes(data []byte) []attrRule {
+	var rules []attrRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+
+		rule := attrRule{Pattern: fields[0], Attrs: make(map[string]bool)}
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-"):
+				rule.Attrs[attr[1:]] = false
+			case strings.HasPrefix(attr, "!"):
+				// unspecified; treated as unset
+				rule.Attrs[attr[1:]] = false
+			default:
+				name, value, found := strings.Cut(attr, "=")
+				switch {
+				case !found || value == "true":
+					rule.Attrs[name] = true
+				case value == "false":
+					rule.Attrs[name] = false
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matchAttrPattern reports whether the pattern of a .gitattributes file at
+// the root of the tree matches the file at p
+// Patterns without a slash match the file name in any directory; others
+// match the whole path, where "**" matches any number of directories
+func matchAttrPattern(pattern, p string) bool {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !anchored && !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(p))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// a trailing "**" matches everything inside, not the directory
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// attrSet reports whether the attribute name is set for the file at p; the
+// last matching rule decides
+func attrSet(rules []attrRule, name, p string) bool {
+	set := false
+	for _, rule := range rules {
+		if value, ok := rule.Attrs[name]; ok && matchAttrPattern(rule.Pattern, p) {
+			set = value
+		}
+	}
+	return set
+}
+
+// readGitattributes returns the rules of the .gitattributes file at the root
+// of tree, or none when there is none
+// Only the root file is read, which is where linguist overrides usually live
+func readGitattributes(repo *git.Repository, tree *git.Tree) []attrRule {
+	entry := tree.EntryByName(".gitattributes")
+	if entry == nil || entry.Type != git.ObjectBlob {
+		return nil
+	}
+
+	blob, err := repo.LookupBlob(entry.Id)
+	if err != nil {
+		GlobalWarnings.add(".gitattributes", err)
+		return nil
+	}
+	defer blob.Free()
+
+	return parseGitattributes(blob.Contents())
+}
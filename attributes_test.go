@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGitattributes(t *testing.T) {
+	data := []byte(`# linguist overrides
+*.pb.go linguist-generated=true -diff
+vendor/** linguist-vendored
+docs/** linguist-vendored=false !linguist-generated
+[attr]binary -diff -merge -text
+*.min.js   linguist-generated  text=auto
+lonely
+`)
+
+	expected := []attrRule{
+		{Pattern: "*.pb.go", Attrs: map[string]bool{"linguist-generated": true, "diff": false}},
+		{Pattern: "vendor/**", Attrs: map[string]bool{"linguist-vendored": true}},
+		{Pattern: "docs/**", Attrs: map[string]bool{"linguist-vendored": false, "linguist-generated": false}},
+		{Pattern: "*.min.js", Attrs: map[string]bool{"linguist-generated": true}},
+	}
+	if got := parseGitattributes(data); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestMatchAttrPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"*.pb.go", "api.pb.go", true},
+		{"*.pb.go", "proto/api/api.pb.go", true},
+		{"*.pb.go", "api.go", false},
+		{"vendor/**", "vendor/lib/lib.go", true},
+		{"vendor/**", "src/vendor/lib.go", false},
+		{"/vendor/*", "vendor/lib.go", true},
+		{"/vendor/*", "vendor/lib/lib.go", false},
+		{"/Makefile", "Makefile", true},
+		{"/Makefile", "src/Makefile", false},
+		{"**/testdata/**", "testdata/a.txt", true},
+		{"**/testdata/**", "pkg/testdata/golden/a.txt", true},
+		{"**/testdata/**", "pkg/testdata", false},
+		{"docs/*.md", "docs/index.md", true},
+		{"docs/*.md", "docs/api/index.md", false},
+	}
+
+	for _, tc := range tests {
+		if got := matchAttrPattern(tc.pattern, tc.path); got != tc.expected {
+			t.Errorf("matchAttrPattern(%q, %q): expected %v, got %v", tc.pattern, tc.path, tc.expected, got)
+		}
+	}
+}
+
+func TestAttrSet(t *testing.T) {
+	rules := parseGitattributes([]byte(`vendor/** linguist-vendored
+vendor/ours/** -linguist-vendored
+`))
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"vendor/lib/lib.go", true},
+		{"vendor/ours/lib.go", false},
+		{"main.go", false},
+	}
+
+	for _, tc := range tests {
+		if got := attrSet(rules, "linguist-vendored", tc.path); got != tc.expected {
+			t.Errorf("attrSet(%q): expected %v, got %v", tc.path, tc.expected, got)
+		}
+	}
+	if attrSet(rules, "linguist-generated", "vendor/lib/lib.go") {
+		t.Errorf("expected linguist-generated to be unset")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// blameHunk is a run of lines of a file that the same commit last changed,
+// copied out of libgit2 so that render jobs can use it
+type blameHunk struct {
+	Lines  int
+	Commit string
+	Author string
+	Date   time.Time
+}
+
+// getBlameHunks blames the file at repoPath, relative to the tree root, as of
+// head
+// Only first parents are followed, so that lines are attributed to commits
+// that have a page
+func getBlameHunks(repo *git.Repository, head *git.Oid, repoPath string) ([]blameHunk, error) {
+	opts, err := git.DefaultBlameOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Flags |= git.BlameFirstParent
+	opts.NewestCommit = head
+
+	blame, err := repo.BlameFile(repoPath, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer blame.Free()
+
+	count := blame.HunkCount()
+	hunks := make([]blameHunk, 0, count)
+	for i := 0; i < count; i++ {
+		hunk, err := blame.HunkByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+
+		h := blameHunk{Lines: int(hunk.LinesInHunk), Commit: hunk.FinalCommitId.String()}
+		if hunk.FinalSignature != nil {
+			h.Author = hunk.FinalSignature.Name
+			h.Date = hunk.FinalSignature.When
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks, nil
+}
+
+// groupBlameLines splits the highlighted lines of a file into groups of
+// consecutive lines from the same commit, merging adjacent hunks of a commit
+// Lines not covered by any hunk end up in a final group without a commit
+func groupBlameLines(hunks []blameHunk, lines []template.HTML) []BlameGroup {
+	var groups []BlameGroup
+
+	start := 0
+	for _, hunk := range hunks {
+		if start >= len(lines) {
+			break
+		}
+		end := min(start+hunk.Lines, len(lines))
+
+		if n := len(groups); n > 0 && groups[n-1].Commit == hunk.Commit {
+			groups[n-1].Lines = append(groups[n-1].Lines, lines[start:end]...)
+		} else {
+			group := BlameGroup{
+				Commit:    hunk.Commit,
+				Author:    hunk.Author,
+				Date:      hunk.Date,
+				StartLine: start + 1,
+				Lines:     lines[start:end:end],
+			}
+			if len(hunk.Commit) >= 8 {
+				group.AbbrevHash = hunk.Commit[:8]
+				group.Link = "/commit/" + hunk.Commit + ".html"
+			}
+			groups = append(groups, group)
+		}
+		start = end
+	}
+
+	if start < len(lines) {
+		groups = append(groups, BlameGroup{StartLine: start + 1, Lines: lines[start:]})
+	}
+	return groups
+}
+
+// writeBlamePage submits the rendering of the blame page next to the file
+// page of the file at treePath, which is rendered from the same inputs
+func writeBlamePage(repo *git.Repository, tr *treeRender, name, treePath string, contents []byte, entry ManifestEntry) {
+	currentPath := treePath + ".blame.html"
+	page := strings.TrimPrefix(currentPath, "/")
+	GlobalManifest.Files[page] = entry
+	if pageUpToDate(page, entry) {
+		return
+	}
+
+	hunks, err := getBlameHunks(repo, tr.head, strings.TrimPrefix(treePath, tr.root+"/"))
+	if err != nil {
+		// without a manifest entry, a blame page of a previous build is removed
+		delete(GlobalManifest.Files, page)
+		GlobalWarnings.add(page, err)
+		return
+	}
+
+	tr.pool.Go(func() error {
+		file, err := os.Create(filepath.Join(Config.DestDir, currentPath))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		err = t.ExecuteTemplate(file, "blame.html", BlameRenderData{
+			GlobalData:  tr.global.atPage(page),
+			Name:        name,
+			FileLink:    treePath + ".html",
+			Groups:      groupBlameLines(hunks, highlightFileContents(name, contents)),
+			FullTree:    tr.fullTree,
+			CurrentPath: treePath + ".html",
+		})
+		if err != nil {
+			GlobalWarnings.add(page, err)
+		}
+		return file.Sync()
+	})
+}
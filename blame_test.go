@@ -0,0 +1,100 @@
+package main
+
+import (
+	"html/template"
+	"testing"
+	"time"
+)
+
+func TestGroupBlameLines(t *testing.T) {
+	a := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	b := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	date := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	lines := []template.HTML{"one", "two", "three", "four", "five"}
+
+	t.Run("merges adjacent hunks of one commit", func(t *testing.T) {
+		hunks := []blameHunk{
+			{Lines: 1, Commit: a, Author: "Alice", Date: date},
+			{Lines: 1, Commit: a, Author: "Alice", Date: date},
+			{Lines: 2, Commit: b, Author: "Bob", Date: date},
+			{Lines: 1, Commit: a, Author: "Alice", Date: date},
+		}
+
+		groups := groupBlameLines(hunks, lines)
+
+		if len(groups) != 3 {
+			t.Fatalf("expected 3 groups, got %d", len(groups))
+		}
+		expected := []struct {
+			commit    string
+			startLine int
+			lines     int
+		}{{a, 1, 2}, {b, 3, 2}, {a, 5, 1}}
+		for i, e := range expected {
+			if groups[i].Commit != e.commit || groups[i].StartLine != e.startLine || len(groups[i].Lines) != e.lines {
+				t.Errorf("group %d: expected %s at %d with %d lines, got %s at %d with %d lines",
+					i, e.commit[:8], e.startLine, e.lines, groups[i].AbbrevHash, groups[i].StartLine, len(groups[i].Lines))
+			}
+		}
+		if groups[1].Link != "/commit/"+b+".html" || groups[1].AbbrevHash != b[:8] || groups[1].Author != "Bob" {
+			t.Errorf("unexpected commit info: %+v", groups[1])
+		}
+		if groups[0].Lines[1] != "two" || groups[2].Lines[0] != "five" {
+			t.Errorf("lines assigned to the wrong groups: %v", groups)
+		}
+	})
+
+	t.Run("keeps lines not covered by any hunk", func(t *testing.T) {
+		groups := groupBlameLines([]blameHunk{{Lines: 2, Commit: a}}, lines)
+
+		if len(groups) != 2 {
+			t.Fatalf("expected 2 groups, got %d", len(groups))
+		}
+		if groups[1].Commit != "" || groups[1].Link != "" || len(groups[1].Lines) != 3 {
+			t.Errorf("unexpected trailing group: %+v", groups[1])
+		}
+	})
+
+	t.Run("ignores hunks past the last line", func(t *testing.T) {
+		groups := groupBlameLines([]blameHunk{{Lines: 10, Commit: a}, {Lines: 1, Commit: b}}, lines)
+
+		if len(groups) != 1 || len(groups[0].Lines) != len(lines) {
+			t.Errorf("expected a single group with every line, got %+v", groups)
+		}
+	})
+}
+
+func TestGetBlameHunks(t *testing.T) {
+	repo, repoPath := createTestRepo(t)
+	defer repo.Free()
+
+	first := createCommitInRepo(t, repo, repoPath, "file.txt", "one\ntwo\n", "First")
+	second := createCommitInRepo(t, repo, repoPath, "file.txt", "one\ntwo\nthree\n", "Second")
+
+	hunks, err := getBlameHunks(repo, second, "file.txt")
+	if err != nil {
+		t.Fatalf("getBlameHunks() failed: %v", err)
+	}
+
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d: %+v", len(hunks), hunks)
+	}
+	if hunks[0].Commit != first.String() || hunks[0].Lines != 2 {
+		t.Errorf("expected the first two lines from the first commit, got %+v", hunks[0])
+	}
+	if hunks[1].Commit != second.String() || hunks[1].Lines != 1 {
+		t.Errorf("expected the last line from the second commit, got %+v", hunks[1])
+	}
+	if hunks[0].Author != "Test User" {
+		t.Errorf("expected author Test User, got %q", hunks[0].Author)
+	}
+
+	// blaming as of the first commit ignores later changes
+	hunks, err = getBlameHunks(repo, first, "file.txt")
+	if err != nil {
+		t.Fatalf("getBlameHunks() failed: %v", err)
+	}
+	if len(hunks) != 1 || hunks[0].Commit != first.String() {
+		t.Errorf("expected a single hunk from the first commit, got %+v", hunks)
+	}
+}
@@ -17,23 +17,47 @@ var (
 		"mul": func(a int, b float64) float64 {
 			return float64(a) * b
 		},
+		"base": pageBase,
 	}
 	templ *template.Template
 	t     *template.Template
 )
 
 type ConfigStruct struct {
-	// the following are configured below:
+	// the following are configured below, or by the configuration files:
 	MaxSummaryLen int
 	GitUrl        string
 	// the following are received from the command line arguments and flags:
-	RepoName   string
-	InstallDir string
-	DestDir    string
-	Force      bool
+	RepoName         string
+	InstallDir       string
+	TemplatesDir     string
+	DestDir          string
+	Force            bool
+	Incremental      bool
+	Jobs             int
+	TreeIdRedirects  bool
+	SubmoduleBaseUrl string
+	RefGlob          string
+	CommitTrees      bool
+	Blame            bool
+	AllParents       bool
+	SplitDiffs       bool
+	DiffMaxLines     int
+	DiffMaxBytes     int
+	DiffMaxFiles     int
+	BaseUrl          string
+	RelativeLinks    bool
+	FeedEntries      int
+	HighlightStyle   string
+	Excludes         []string // patterns of paths left out of the trees
+	LogPageSize      int
+	LogArchives      bool
+	Strict           bool
 }
 
-var Config = ConfigStruct{MaxSummaryLen: 20, GitUrl: "github.com/hltk"}
+var Config = ConfigStruct{MaxSummaryLen: 20, GitUrl: "github.com/hltk", Jobs: 1, LogPageSize: 100,
+	DiffMaxLines: 2000, DiffMaxBytes: 1 << 20, DiffMaxFiles: 300, FeedEntries: 20,
+	HighlightStyle: "github"}
 
 type GlobalRenderData struct {
 	Config      *ConfigStruct
@@ -43,10 +67,22 @@ type GlobalRenderData struct {
 	BranchName  string
 	BranchCount int
 	TagCount    int
+	Depth       int // the directories between the page and the root of the site
 }
 
 var GlobalDataGlobal = GlobalRenderData{Config: &Config,
-	Links: []LinkListElem{{"branches", "/branches.html"}, {"tags", "/tags.html"}, {"tree", "/tree"}, {"log", "/log"}}}
+	Links: []LinkListElem{{"branches", "/branches.html"}, {"tags", "/tags.html"}, {"tree", "/tree/index.html"}, {"log", "/log/index.html"}}}
 
-// GlobalFullTree stores the complete repository tree structure (flattened)
-var GlobalFullTree []FlatTreeItem
+// GlobalWarnings collects the problems of the current build that did not stop it
+var GlobalWarnings = &warningList{}
+
+// GlobalRefIndex records the refs containing every commit and the nearest
+// tag of every commit, for commit pages; nil leaves both out
+var GlobalRefIndex *refIndex
+
+// GlobalManifest records the pages rendered by the current build, and
+// GlobalPrevManifest those of the previous build when running incrementally
+var (
+	GlobalManifest     = newManifest()
+	GlobalPrevManifest = newManifest()
+)
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// configFileName is the name of the configuration file in the install
+// directory, for the whole site, and in the git directory of a repository,
+// for that repository
+const configFileName = "gitgo.json"
+
+// configSettings returns the settings of c that configuration files and the
+// gitgo.* keys of git config can set, by the name of their flag
+func configSettings(c *ConfigStruct) map[string]any {
+	return map[string]any{
+		"git-url":            &c.GitUrl,
+		"base-url":           &c.BaseUrl,
+		"relative-links":     &c.RelativeLinks,
+		"max-summary-len":    &c.MaxSummaryLen,
+		"highlight-style":    &c.HighlightStyle,
+		"excludes":           &c.Excludes,
+		"tree-id-redirects":  &c.TreeIdRedirects,
+		"submodule-base-url": &c.SubmoduleBaseUrl,
+		"commit-trees":       &c.CommitTrees,
+		"diff-max-lines":     &c.DiffMaxLines,
+		"diff-max-bytes":     &c.DiffMaxBytes,
+		"diff-max-files":     &c.DiffMaxFiles,
+		"log-page-size":      &c.LogPageSize,
+		"log-archives":       &c.LogArchives,
+		"all-parents":        &c.AllParents,
+		"split-diffs":        &c.SplitDiffs,
+		"blame":              &c.Blame,
+		"feed-entries":       &c.FeedEntries,
+		"ref-glob":           &c.RefGlob,
+	}
+}
+
+// minSummaryLen is the shortest summary length that leaves room for the
+// ellipsis of shortened summaries
+const minSummaryLen = 4
+
+// checkSetting returns an error for a value of the setting name of c that
+// the pages cannot be generated with
+func checkSetting(c *ConfigStruct, name string) error {
+	if name == "max-summary-len" && c.MaxSummaryLen < minSummaryLen {
+		return fmt.Errorf("must be at least %d, got %d", minSummaryLen, c.MaxSummaryLen)
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags given on the command line, whose
+// values take precedence over configuration files
+func setFlags(flags *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyConfigJSON sets the settings of c found in the JSON object data,
+// except those named in keep
+func applyConfigJSON(c *ConfigStruct, data []byte, keep map[string]bool) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	settings := configSettings(c)
+	for name, value := range values {
+		setting, ok := settings[name]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if keep[name] {
+			continue
+		}
+		// lists are replaced, not filled in place where they may be shared
+		if list, ok := setting.(*[]string); ok {
+			*list = nil
+		}
+		err := json.Unmarshal(value, setting)
+		if err == nil {
+			err = checkSetting(c, name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// loadConfigFile applies the configuration file at path to c, except the
+// settings named in keep; a missing file is no error
+func loadConfigFile(c *ConfigStruct, path string, keep map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := applyConfigJSON(c, data, keep); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// parseGitBool parses a boolean the way git config does
+func parseGitBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// applyGitConfig sets the settings of c given as gitgo.* keys of git config,
+// values by lowercase key, except those named in keep
+// Every value of a list setting such as gitgo.excludes is one item; other
+// settings take their last value
+func applyGitConfig(c *ConfigStruct, values map[string][]string, keep map[string]bool) error {
+	settings := configSettings(c)
+	for name, setting := range settings {
+		all, ok := values[strings.ToLower(name)]
+		if !ok || len(all) == 0 || keep[name] {
+			continue
+		}
+		last := all[len(all)-1]
+
+		var err error
+		switch setting := setting.(type) {
+		case *string:
+			*setting = last
+		case *int:
+			*setting, err = strconv.Atoi(last)
+		case *bool:
+			*setting, err = parseGitBool(last)
+		case *[]string:
+			*setting = append([]string(nil), all...)
+		}
+		if err == nil {
+			err = checkSetting(c, name)
+		}
+		if err != nil {
+			return fmt.Errorf("gitgo.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// loadRepoConfig applies the per-repository configuration of the repository
+// at repoPath to c, except the settings named in keep: the gitgo.json file
+// of its git directory, then the gitgo.* keys of its git config
+func loadRepoConfig(c *ConfigStruct, repoPath string, keep map[string]bool) error {
+	repo, err := git.OpenRepositoryExtended(repoPath, git.RepositoryOpenNoSearch, "")
+	if err != nil {
+		return err
+	}
+	defer repo.Free()
+
+	err = loadConfigFile(c, filepath.Join(repo.Path(), configFileName), keep)
+	if err != nil {
+		return err
+	}
+
+	config, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	defer config.Free()
+	iter, err := config.NewIteratorGlob(`^gitgo\.`)
+	if err != nil {
+		return err
+	}
+	defer iter.Free()
+
+	values := make(map[string][]string)
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			break
+		}
+		name := strings.TrimPrefix(entry.Name, "gitgo.")
+		values[name] = append(values[name], entry.Value)
+	}
+	return applyGitConfig(c, values, keep)
+}
+
+// excludedPath reports whether the file or directory at p, relative to the
+// root of the tree, matches one of Config.Excludes, which are patterns in
+// the format of .gitattributes
+func excludedPath(p string) bool {
+	for _, pattern := range Config.Excludes {
+		if matchAttrPattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
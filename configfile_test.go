@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigJSON(t *testing.T) {
+	t.Run("sets the settings found", func(t *testing.T) {
+		c := ConfigStruct{MaxSummaryLen: 20, HighlightStyle: "github"}
+		data := `{"git-url": "git.example.com", "max-summary-len": 40, "blame": true, "excludes": ["vendor/**", "*.min.js"]}`
+		if err := applyConfigJSON(&c, []byte(data), nil); err != nil {
+			t.Fatalf("applyConfigJSON() failed: %v", err)
+		}
+
+		if c.GitUrl != "git.example.com" || c.MaxSummaryLen != 40 || !c.Blame {
+			t.Errorf("settings not applied: %+v", c)
+		}
+		if c.HighlightStyle != "github" {
+			t.Errorf("expected unset settings to keep their value, got %q", c.HighlightStyle)
+		}
+		if expected := []string{"vendor/**", "*.min.js"}; !reflect.DeepEqual(c.Excludes, expected) {
+			t.Errorf("expected excludes %v, got %v", expected, c.Excludes)
+		}
+	})
+
+	t.Run("keeps the settings given as flags", func(t *testing.T) {
+		c := ConfigStruct{MaxSummaryLen: 30}
+		err := applyConfigJSON(&c, []byte(`{"max-summary-len": 40, "blame": true}`), map[string]bool{"max-summary-len": true})
+		if err != nil {
+			t.Fatalf("applyConfigJSON() failed: %v", err)
+		}
+		if c.MaxSummaryLen != 30 {
+			t.Errorf("expected the flag to win, got %d", c.MaxSummaryLen)
+		}
+		if !c.Blame {
+			t.Errorf("expected the other settings to be applied")
+		}
+	})
+
+	t.Run("replaces lists without changing copies", func(t *testing.T) {
+		site := ConfigStruct{Excludes: []string{"a", "b"}}
+		c := site
+		if err := applyConfigJSON(&c, []byte(`{"excludes": ["c"]}`), nil); err != nil {
+			t.Fatalf("applyConfigJSON() failed: %v", err)
+		}
+		if !reflect.DeepEqual(site.Excludes, []string{"a", "b"}) {
+			t.Errorf("expected the site excludes to be unchanged, got %v", site.Excludes)
+		}
+		if !reflect.DeepEqual(c.Excludes, []string{"c"}) {
+			t.Errorf("expected excludes [c], got %v", c.Excludes)
+		}
+	})
+
+	t.Run("rejects unknown settings and wrong types", func(t *testing.T) {
+		var c ConfigStruct
+		err := applyConfigJSON(&c, []byte(`{"destdir": "out"}`), nil)
+		if err == nil || !strings.Contains(err.Error(), "destdir") {
+			t.Errorf("expected an error naming the unknown setting, got %v", err)
+		}
+		err = applyConfigJSON(&c, []byte(`{"blame": "yes"}`), nil)
+		if err == nil || !strings.Contains(err.Error(), "blame") {
+			t.Errorf("expected an error naming the setting, got %v", err)
+		}
+	})
+
+	t.Run("rejects summary lengths too short to shorten summaries", func(t *testing.T) {
+		for _, value := range []string{"0", "3", "-1"} {
+			c := ConfigStruct{MaxSummaryLen: 20}
+			err := applyConfigJSON(&c, []byte(`{"max-summary-len": `+value+`}`), nil)
+			if err == nil || !strings.Contains(err.Error(), "max-summary-len") {
+				t.Errorf("%s: expected an error naming the setting, got %v", value, err)
+			}
+		}
+		c := ConfigStruct{MaxSummaryLen: 20}
+		if err := applyConfigJSON(&c, []byte(`{"max-summary-len": 4}`), nil); err != nil || c.MaxSummaryLen != 4 {
+			t.Errorf("expected the shortest length to be accepted, got %d, %v", c.MaxSummaryLen, err)
+		}
+	})
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	c := ConfigStruct{LogPageSize: 100}
+
+	if err := loadConfigFile(&c, filepath.Join(dir, configFileName), nil); err != nil {
+		t.Errorf("expected no error for a missing file, got %v", err)
+	}
+
+	path := filepath.Join(dir, configFileName)
+	if err := os.WriteFile(path, []byte(`{"log-page-size": 50}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := loadConfigFile(&c, path, nil); err != nil {
+		t.Fatalf("loadConfigFile() failed: %v", err)
+	}
+	if c.LogPageSize != 50 {
+		t.Errorf("expected a log page size of 50, got %d", c.LogPageSize)
+	}
+
+	if err := os.WriteFile(path, []byte(`{`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := loadConfigFile(&c, path, nil); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
+
+func TestParseGitBool(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+		wantErr  bool
+	}{
+		{"true", true, false},
+		{"Yes", true, false},
+		{"on", true, false},
+		{"1", true, false},
+		{"false", false, false},
+		{"no", false, false},
+		{"", false, false},
+		{"maybe", false, true},
+	}
+
+	for _, tc := range tests {
+		got, err := parseGitBool(tc.value)
+		if (err != nil) != tc.wantErr || got != tc.expected {
+			t.Errorf("parseGitBool(%q) = %v, %v", tc.value, got, err)
+		}
+	}
+}
+
+func TestApplyGitConfig(t *testing.T) {
+	c := ConfigStruct{MaxSummaryLen: 20, GitUrl: "github.com/hltk"}
+	values := map[string][]string{
+		"max-summary-len": {"30", "40"},
+		"split-diffs":     {"yes"},
+		"highlight-style": {"monokai"},
+		"excludes":        {"vendor/**", "*.min.js"},
+		"git-url":         {"git.example.com"},
+	}
+	if err := applyGitConfig(&c, values, map[string]bool{"git-url": true}); err != nil {
+		t.Fatalf("applyGitConfig() failed: %v", err)
+	}
+
+	if c.MaxSummaryLen != 40 {
+		t.Errorf("expected the last value 40, got %d", c.MaxSummaryLen)
+	}
+	if !c.SplitDiffs || c.HighlightStyle != "monokai" {
+		t.Errorf("settings not applied: %+v", c)
+	}
+	if expected := []string{"vendor/**", "*.min.js"}; !reflect.DeepEqual(c.Excludes, expected) {
+		t.Errorf("expected excludes %v, got %v", expected, c.Excludes)
+	}
+	if c.GitUrl != "github.com/hltk" {
+		t.Errorf("expected the flag to win, got %q", c.GitUrl)
+	}
+
+	err := applyGitConfig(&c, map[string][]string{"log-page-size": {"many"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "gitgo.log-page-size") {
+		t.Errorf("expected an error naming the key, got %v", err)
+	}
+
+	err = applyGitConfig(&c, map[string][]string{"max-summary-len": {"0"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "gitgo.max-summary-len") {
+		t.Errorf("expected an error naming the key, got %v", err)
+	}
+}
+
+func TestLoadRepoConfig(t *testing.T) {
+	repo, repoPath := createTestRepo(t)
+	defer repo.Free()
+
+	err := os.WriteFile(filepath.Join(repo.Path(), configFileName), []byte(`{"log-page-size": 10, "blame": true}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	config, err := repo.Config()
+	if err != nil {
+		t.Fatalf("failed to open config: %v", err)
+	}
+	if err := config.SetString("gitgo.log-page-size", "25"); err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+	config.Free()
+
+	c := ConfigStruct{LogPageSize: 100}
+	if err := loadRepoConfig(&c, repoPath, nil); err != nil {
+		t.Fatalf("loadRepoConfig() failed: %v", err)
+	}
+	if c.LogPageSize != 25 {
+		t.Errorf("expected git config to override the file, got %d", c.LogPageSize)
+	}
+	if !c.Blame {
+		t.Errorf("expected the file to be applied")
+	}
+}
+
+func TestExcludedPath(t *testing.T) {
+	saved := Config.Excludes
+	defer func() { Config.Excludes = saved }()
+	Config.Excludes = []string{"vendor/**", "*.min.js", "/docs"}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"vendor/lib/a.go", true},
+		{"vendor", false},
+		{"static/app.min.js", true},
+		{"docs", true},
+		{"src/docs", false},
+		{"main.go", false},
+	}
+
+	for _, tc := range tests {
+		if got := excludedPath(tc.path); got != tc.expected {
+			t.Errorf("excludedPath(%q) = %v, expected %v", tc.path, got, tc.expected)
+		}
+	}
+}
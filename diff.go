@@ -0,0 +1,619 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	htmlpkg "html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// fileDiff is a file changed by a commit, as found by libgit2, with its
+// unified diff
+// The new path picks the lexer for the lines of the diff
+type fileDiff struct {
+	OldPath    string
+	NewPath    string
+	Status     string // "added", "modified", "deleted", "renamed", "copied" or "typechange"
+	Similarity int    // of renamed and copied files, in percent
+	Binary     bool   // binary files have no text
+	OldSize    int    // of binary files, in bytes
+	NewSize    int
+	OldImage   string // the links to both sides of images, if any
+	NewImage   string
+	Text       string
+	Collapsed  string // why the diff is left out of the commit page, if it is
+	Link       string // the page of collapsed diffs that have one
+}
+
+// Reasons for collapsing the diff of a file on the commit page
+const (
+	collapsedGenerated = "generated file"
+	collapsedVendored  = "vendored file"
+	collapsedLarge     = "large diff"
+	// the diff is too large even for a page of its own
+	collapsedTooLarge = "diff too large to show"
+)
+
+// diffLine is a line of a hunk with its numbers in the old and the new file,
+// zero on the side the line does not exist on
+type diffLine struct {
+	Origin  byte // ' ', '+', '-' or '\\' for "\ No newline at end of file"
+	OldLine int
+	NewLine int
+	Content string
+	HTML    template.HTML // the escaped content, highlighted by highlightHunk
+}
+
+type diffHunk struct {
+	Header string
+	Lines  []diffLine
+}
+
+// filePatch is the unified diff of a single file: the header lines up to the
+// first hunk, such as "diff --git" and "+++", and the hunks
+type filePatch struct {
+	Header    []string
+	Hunks     []diffHunk
+	Additions int
+	Deletions int
+}
+
+// parseHunkHeader returns the first old and new line numbers of a hunk
+// header such as "@@ -1,4 +1,5 @@ func main() {"
+func parseHunkHeader(header string) (oldStart, newStart int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	start := func(field string) int {
+		s, _, _ := strings.Cut(field[1:], ",")
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return start(fields[1]), start(fields[2])
+}
+
+// parsePatch splits the unified diff of a single file into its header and
+// hunks and numbers the lines of the hunks
+func parsePatch(text string) filePatch {
+	var patch filePatch
+	var hunk *diffHunk
+	var oldLine, newLine int
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			patch.Hunks = append(patch.Hunks, diffHunk{Header: line})
+			hunk = &patch.Hunks[len(patch.Hunks)-1]
+			oldLine, newLine = parseHunkHeader(line)
+			continue
+		}
+		if hunk == nil {
+			patch.Header = append(patch.Header, line)
+			continue
+		}
+
+		l := diffLine{Origin: ' '}
+		if line != "" {
+			l.Origin, l.Content = line[0], line[1:]
+		}
+		l.HTML = template.HTML(htmlpkg.EscapeString(l.Content))
+		switch l.Origin {
+		case '-':
+			l.OldLine = oldLine
+			oldLine++
+			patch.Deletions++
+		case '+':
+			l.NewLine = newLine
+			newLine++
+			patch.Additions++
+		case '\\':
+			l.Content = line
+			l.HTML = template.HTML(htmlpkg.EscapeString(line))
+		default:
+			l.OldLine, l.NewLine = oldLine, newLine
+			oldLine++
+			newLine++
+		}
+		hunk.Lines = append(hunk.Lines, l)
+	}
+	return patch
+}
+
+// splitHunk lays the lines of a hunk out side by side: unchanged lines on
+// both sides, and each run of removed lines next to the run of added lines
+// that follows it
+func splitHunk(hunk diffHunk) []SplitDiffRow {
+	var rows []SplitDiffRow
+	var removed, added []diffLine
+
+	flush := func() {
+		for i := 0; i < max(len(removed), len(added)); i++ {
+			row := SplitDiffRow{}
+			if i < len(removed) {
+				row.Old = splitCell(removed[i], removed[i].OldLine, "diff-del")
+			} else {
+				row.Old.Class = "diff-empty"
+			}
+			if i < len(added) {
+				row.New = splitCell(added[i], added[i].NewLine, "diff-add")
+			} else {
+				row.New.Class = "diff-empty"
+			}
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+
+	for _, line := range hunk.Lines {
+		switch line.Origin {
+		case '-':
+			if len(added) > 0 {
+				flush()
+			}
+			removed = append(removed, line)
+		case '+':
+			added = append(added, line)
+		case '\\':
+			flush()
+			note := splitCell(line, 0, "diff-note")
+			rows = append(rows, SplitDiffRow{Old: note, New: note})
+		default:
+			flush()
+			rows = append(rows, SplitDiffRow{
+				Old: splitCell(line, line.OldLine, ""),
+				New: splitCell(line, line.NewLine, ""),
+			})
+		}
+	}
+	flush()
+	return rows
+}
+
+func splitCell(line diffLine, number int, class string) SplitDiffCell {
+	return SplitDiffCell{Line: number, Content: line.HTML, Class: class}
+}
+
+// splitHunks returns the side by side view of the hunks of patch
+func splitHunks(patch filePatch) []SplitDiffHunk {
+	hunks := make([]SplitDiffHunk, 0, len(patch.Hunks))
+	for _, hunk := range patch.Hunks {
+		hunks = append(hunks, SplitDiffHunk{Header: hunk.Header, Rows: splitHunk(hunk)})
+	}
+	return hunks
+}
+
+// unifiedLines returns the lines of the unified view of patch
+func unifiedLines(patch filePatch) []template.HTML {
+	var lines []template.HTML
+	if len(patch.Header) > 0 {
+		lines = append(lines, highlightDiffLines(strings.Join(patch.Header, "\n"))...)
+	}
+	for _, hunk := range patch.Hunks {
+		lines = append(lines, template.HTML(htmlpkg.EscapeString(hunk.Header)))
+		for _, line := range hunk.Lines {
+			switch line.Origin {
+			case '+':
+				lines = append(lines, `<span class="diff-add">+`+line.HTML+`</span>`)
+			case '-':
+				lines = append(lines, `<span class="diff-del">-`+line.HTML+`</span>`)
+			case '\\':
+				lines = append(lines, line.HTML)
+			default:
+				lines = append(lines, " "+line.HTML)
+			}
+		}
+	}
+	return lines
+}
+
+// diffAnchor returns the id of the section of the file at path on a commit
+// page, which stays the same across commits
+func diffAnchor(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return "diff-" + hex.EncodeToString(sum[:8])
+}
+
+// diffFiles highlights the diffs of the files of a commit and returns the
+// files as shown on the commit page, in both views, along with the total
+// counts of added and deleted lines
+// The bars of the summary are relative to the file with the most changes
+func diffFiles(diffs []fileDiff) (files []DiffFile, additions, deletions int) {
+	files = make([]DiffFile, 0, len(diffs))
+	largest := 0
+	for _, d := range diffs {
+		file := DiffFile{
+			Anchor:     diffAnchor(d.NewPath),
+			Status:     d.Status,
+			OldPath:    d.OldPath,
+			NewPath:    d.NewPath,
+			Similarity: d.Similarity,
+			Binary:     d.Binary,
+			OldSize:    d.OldSize,
+			NewSize:    d.NewSize,
+			OldImage:   d.OldImage,
+			NewImage:   d.NewImage,
+		}
+		if d.Collapsed != "" {
+			file.Collapsed, file.Link = d.Collapsed, d.Link
+			file.Additions, file.Deletions = countChanges(d.Text)
+		} else if !d.Binary {
+			patch := highlightPatch(d)
+			file.Additions, file.Deletions = patch.Additions, patch.Deletions
+			file.Lines = unifiedLines(patch)
+			file.Header, file.Hunks = patch.Header, splitHunks(patch)
+		}
+
+		additions += file.Additions
+		deletions += file.Deletions
+		largest = max(largest, file.Additions+file.Deletions)
+		files = append(files, file)
+	}
+
+	if largest > 0 {
+		for i := range files {
+			files[i].AddBar = files[i].Additions * 100 / largest
+			files[i].DelBar = files[i].Deletions * 100 / largest
+		}
+	}
+	return files, additions, deletions
+}
+
+// limitDiffs applies the diff limits of the configuration to the files of a
+// commit, in order, and returns the files to show along with the number of
+// files dropped past Config.DiffMaxFiles
+// Diffs of files marked linguist-generated or linguist-vendored by attrs,
+// longer than Config.DiffMaxLines or past Config.DiffMaxBytes in total are
+// collapsed; a zero limit is no limit
+func limitDiffs(diffs []fileDiff, attrs []attrRule) (shown []fileDiff, dropped int) {
+	if Config.DiffMaxFiles > 0 && len(diffs) > Config.DiffMaxFiles {
+		diffs, dropped = diffs[:Config.DiffMaxFiles], len(diffs)-Config.DiffMaxFiles
+	}
+
+	shown = make([]fileDiff, len(diffs))
+	total := 0
+	for i, d := range diffs {
+		size := len(d.Text)
+		switch {
+		case d.Binary || size == 0:
+		case Config.DiffMaxBytes > 0 && size > Config.DiffMaxBytes:
+			d.Collapsed = collapsedTooLarge
+		case attrSet(attrs, "linguist-generated", d.NewPath):
+			d.Collapsed = collapsedGenerated
+		case attrSet(attrs, "linguist-vendored", d.NewPath):
+			d.Collapsed = collapsedVendored
+		case Config.DiffMaxLines > 0 && strings.Count(d.Text, "\n") > Config.DiffMaxLines:
+			d.Collapsed = collapsedLarge
+		case Config.DiffMaxBytes > 0 && total+size > Config.DiffMaxBytes:
+			d.Collapsed = collapsedLarge
+		default:
+			total += size
+		}
+		shown[i] = d
+	}
+	return shown, dropped
+}
+
+// countChanges returns the number of added and deleted lines of the unified
+// diff of a single file without parsing it
+func countChanges(text string) (additions, deletions int) {
+	inHunks := false
+	for len(text) > 0 {
+		line, rest, _ := strings.Cut(text, "\n")
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunks = true
+		case !inHunks:
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+		text = rest
+	}
+	return additions, deletions
+}
+
+// highlightPatch parses the diff of a file and highlights its lines with the
+// lexer of its new path
+func highlightPatch(d fileDiff) filePatch {
+	patch := parsePatch(d.Text)
+	if len(patch.Hunks) > 0 {
+		lexer := lexers.Match(d.NewPath)
+		if lexer == nil {
+			lexer = lexers.Fallback
+		}
+		lexer = chroma.Coalesce(lexer)
+		for i := range patch.Hunks {
+			highlightHunk(lexer, &patch.Hunks[i])
+		}
+	}
+	return patch
+}
+
+// highlightHunk highlights the old and the new side of a hunk with lexer and
+// marks the changed ranges of the removed and added lines paired by
+// changedLinePairs
+// Each side is lexed as a whole, so that constructs spanning several lines of
+// the hunk are recognized
+func highlightHunk(lexer chroma.Lexer, hunk *diffHunk) {
+	var oldIndexes, newIndexes []int
+	for i, line := range hunk.Lines {
+		switch line.Origin {
+		case '-':
+			oldIndexes = append(oldIndexes, i)
+		case '+':
+			newIndexes = append(newIndexes, i)
+		case ' ':
+			oldIndexes = append(oldIndexes, i)
+			newIndexes = append(newIndexes, i)
+		}
+	}
+
+	changed := make(map[int][]diffSpan)
+	for _, pair := range changedLinePairs(hunk.Lines) {
+		old, new := hunk.Lines[pair[0]].Content, hunk.Lines[pair[1]].Content
+		changed[pair[0]], changed[pair[1]] = changedRanges(old, new)
+	}
+
+	for _, indexes := range [][]int{oldIndexes, newIndexes} {
+		contents := make([]string, len(indexes))
+		for i, index := range indexes {
+			contents[i] = hunk.Lines[index].Content
+		}
+		tokens := tokeniseLines(lexer, contents)
+		for i, index := range indexes {
+			// context lines are on both sides and highlighted the same way
+			hunk.Lines[index].HTML = renderDiffTokens(tokens[i], changed[index])
+		}
+	}
+}
+
+// changedLinePairs pairs each run of removed lines of a hunk with the run of
+// added lines that follows it, line by line, returning indexes into lines
+// These are the pairs that the side by side view shows next to each other
+func changedLinePairs(lines []diffLine) [][2]int {
+	var pairs [][2]int
+	for i := 0; i < len(lines); {
+		if lines[i].Origin != '-' {
+			i++
+			continue
+		}
+		removed := i
+		for i < len(lines) && lines[i].Origin == '-' {
+			i++
+		}
+		added := i
+		for i < len(lines) && lines[i].Origin == '+' {
+			i++
+		}
+		for k := 0; removed+k < added && added+k < i; k++ {
+			pairs = append(pairs, [2]int{removed + k, added + k})
+		}
+	}
+	return pairs
+}
+
+// tokeniseLines lexes lines as one text and returns the tokens of each line,
+// falling back to plain text when lexing fails
+func tokeniseLines(lexer chroma.Lexer, lines []string) [][]chroma.Token {
+	plain := func() [][]chroma.Token {
+		result := make([][]chroma.Token, len(lines))
+		for i, line := range lines {
+			result[i] = []chroma.Token{{Type: chroma.Text, Value: line}}
+		}
+		return result
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	iterator, err := lexer.Tokenise(nil, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return plain()
+	}
+	split := chroma.SplitTokensIntoLines(iterator.Tokens())
+	if len(split) < len(lines) {
+		return plain()
+	}
+
+	result := make([][]chroma.Token, len(lines))
+	for i := range lines {
+		var text strings.Builder
+		for j := range split[i] {
+			split[i][j].Value = strings.TrimSuffix(split[i][j].Value, "\n")
+			text.WriteString(split[i][j].Value)
+		}
+		// lexers are expected to keep the text as is; make sure of it
+		if text.String() != lines[i] {
+			return plain()
+		}
+		result[i] = split[i]
+	}
+	return result
+}
+
+// tokenClass returns the CSS class chroma uses for tokens of type tt
+func tokenClass(tt chroma.TokenType) string {
+	for ; tt != 0; tt = tt.Parent() {
+		if class, ok := chroma.StandardTypes[tt]; ok {
+			return class
+		}
+	}
+	return chroma.StandardTypes[tt]
+}
+
+// renderDiffTokens returns the HTML of the tokens of a line, marking the
+// bytes within changed with the diff-word class
+func renderDiffTokens(tokens []chroma.Token, changed []diffSpan) template.HTML {
+	var b strings.Builder
+	offset := 0
+	for _, token := range tokens {
+		class := tokenClass(token.Type)
+		value := token.Value
+		for value != "" {
+			// the part of the token up to the next change of marking
+			end := len(value)
+			inChange := false
+			for _, span := range changed {
+				if offset < span.Start {
+					end = min(end, span.Start-offset)
+				} else if offset < span.End {
+					inChange = true
+					end = min(end, span.End-offset)
+				}
+			}
+
+			classes := class
+			if inChange {
+				classes = strings.TrimSpace(class + " diff-word")
+			}
+			text := htmlpkg.EscapeString(value[:end])
+			if classes == "" {
+				b.WriteString(text)
+			} else {
+				b.WriteString(`<span class="` + classes + `">` + text + `</span>`)
+			}
+			offset += end
+			value = value[end:]
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// diffSpan is the range of bytes [Start, End) of a line
+type diffSpan struct {
+	Start int
+	End   int
+}
+
+// maxWordDiffCells bounds the size of the table of changedRanges, beyond
+// which only the common prefix and suffix of the lines are kept
+const maxWordDiffCells = 1 << 20
+
+// splitWords splits a line into runs of letters and digits, runs of spaces
+// and single other characters
+func splitWords(line string) []string {
+	kind := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	var words []string
+	start, prev := 0, -1
+	for i, r := range line {
+		k := kind(r)
+		if i > start && (k == 0 || k != prev) {
+			words = append(words, line[start:i])
+			start = i
+		}
+		prev = k
+	}
+	if start < len(line) {
+		words = append(words, line[start:])
+	}
+	return words
+}
+
+// changedRanges returns the ranges of old and new that differ, word by word,
+// or nothing when the lines have no word but spaces in common, as marking the
+// whole line adds nothing to the removed and added line
+func changedRanges(old, new string) ([]diffSpan, []diffSpan) {
+	a, b := splitWords(old), splitWords(new)
+
+	var keepA, keepB []bool
+	if len(a)*len(b) <= maxWordDiffCells {
+		keepA, keepB = commonWords(a, b)
+	} else {
+		keepA, keepB = commonEnds(a, b)
+	}
+
+	common := false
+	for i, keep := range keepA {
+		if keep && strings.TrimSpace(a[i]) != "" {
+			common = true
+			break
+		}
+	}
+	if !common {
+		return nil, nil
+	}
+	return wordSpans(a, keepA), wordSpans(b, keepB)
+}
+
+// commonWords marks the words of a and b that are part of their longest
+// common subsequence
+func commonWords(a, b []string) ([]bool, []bool) {
+	// lengths[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	keepA, keepB := make([]bool, len(a)), make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			keepA[i], keepB[j] = true, true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return keepA, keepB
+}
+
+// commonEnds marks the words of a and b in their common prefix and suffix
+func commonEnds(a, b []string) ([]bool, []bool) {
+	keepA, keepB := make([]bool, len(a)), make([]bool, len(b))
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		keepA[prefix], keepB[prefix] = true, true
+		prefix++
+	}
+	for i, j := len(a)-1, len(b)-1; i >= prefix && j >= prefix && a[i] == b[j]; i, j = i-1, j-1 {
+		keepA[i], keepB[j] = true, true
+	}
+	return keepA, keepB
+}
+
+// wordSpans returns the byte ranges of the words not kept, merging adjacent
+// ones
+func wordSpans(words []string, keep []bool) []diffSpan {
+	var spans []diffSpan
+	offset := 0
+	for i, word := range words {
+		if !keep[i] {
+			if n := len(spans); n > 0 && spans[n-1].End == offset {
+				spans[n-1].End += len(word)
+			} else {
+				spans = append(spans, diffSpan{Start: offset, End: offset + len(word)})
+			}
+		}
+		offset += len(word)
+	}
+	return spans
+}
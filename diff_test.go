@@ -0,0 +1,367 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+const testPatch = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@ package main
+ package main
+-var a = 1
+-var b = 2
++var a = 10
+ var c = 3
++var d = 4
+@@ -10,2 +10,2 @@ func main() {
+-	return
++	os.Exit(0)
+\ No newline at end of file
+`
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		old, new int
+	}{
+		{"@@ -1,4 +1,5 @@ func main() {", 1, 1},
+		{"@@ -10 +12,3 @@", 10, 12},
+		{"@@ -0,0 +1 @@", 0, 1},
+		{"@@ broken", 0, 0},
+	}
+
+	for _, tc := range tests {
+		old, new := parseHunkHeader(tc.header)
+		if old != tc.old || new != tc.new {
+			t.Errorf("%q: expected %d, %d, got %d, %d", tc.header, tc.old, tc.new, old, new)
+		}
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	patch := parsePatch(testPatch)
+
+	if len(patch.Header) != 4 || patch.Header[3] != "+++ b/main.go" {
+		t.Errorf("expected the 4 header lines, got %q", patch.Header)
+	}
+	if len(patch.Hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(patch.Hunks))
+	}
+
+	expected := []diffLine{
+		{Origin: ' ', OldLine: 1, NewLine: 1, Content: "package main", HTML: "package main"},
+		{Origin: '-', OldLine: 2, Content: "var a = 1", HTML: "var a = 1"},
+		{Origin: '-', OldLine: 3, Content: "var b = 2", HTML: "var b = 2"},
+		{Origin: '+', NewLine: 2, Content: "var a = 10", HTML: "var a = 10"},
+		{Origin: ' ', OldLine: 4, NewLine: 3, Content: "var c = 3", HTML: "var c = 3"},
+		{Origin: '+', NewLine: 4, Content: "var d = 4", HTML: "var d = 4"},
+	}
+	if !reflect.DeepEqual(patch.Hunks[0].Lines, expected) {
+		t.Errorf("expected %+v, got %+v", expected, patch.Hunks[0].Lines)
+	}
+
+	last := patch.Hunks[1].Lines[2]
+	if last.Origin != '\\' || last.Content != `\ No newline at end of file` {
+		t.Errorf("expected the no newline note, got %+v", last)
+	}
+}
+
+func TestSplitHunk(t *testing.T) {
+	rows := splitHunk(parsePatch(testPatch).Hunks[0])
+
+	type side struct {
+		line    int
+		content string
+		class   string
+	}
+	expected := [][2]side{
+		{{1, "package main", ""}, {1, "package main", ""}},
+		{{2, "var a = 1", "diff-del"}, {2, "var a = 10", "diff-add"}},
+		{{3, "var b = 2", "diff-del"}, {0, "", "diff-empty"}},
+		{{4, "var c = 3", ""}, {3, "var c = 3", ""}},
+		{{0, "", "diff-empty"}, {4, "var d = 4", "diff-add"}},
+	}
+
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d: %+v", len(expected), len(rows), rows)
+	}
+	for i, row := range rows {
+		got := [2]side{
+			{row.Old.Line, string(row.Old.Content), row.Old.Class},
+			{row.New.Line, string(row.New.Content), row.New.Class},
+		}
+		if got != expected[i] {
+			t.Errorf("row %d: expected %+v, got %+v", i, expected[i], got)
+		}
+	}
+}
+
+func TestSplitHunks(t *testing.T) {
+	hunks := splitHunks(parsePatch(testPatch))
+	if len(hunks) != 2 || hunks[1].Header != "@@ -10,2 +10,2 @@ func main() {" {
+		t.Errorf("unexpected hunks: %+v", hunks)
+	}
+
+	// markup in the diff is escaped
+	hunks = splitHunks(parsePatch("@@ -1 +1 @@\n-<b>\n+<i>"))
+	if got := hunks[0].Rows[0].New.Content; got != "&lt;i&gt;" {
+		t.Errorf("expected escaped content, got %q", got)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"foo(bar, 42)", []string{"foo", "(", "bar", ",", " ", "42", ")"}},
+		{"  x  ==y", []string{"  ", "x", "  ", "=", "=", "y"}},
+		{"héllo_wörld", []string{"héllo_wörld"}},
+		{"", nil},
+	}
+
+	for _, tc := range tests {
+		if got := splitWords(tc.line); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.line, tc.expected, got)
+		}
+	}
+}
+
+func TestChangedRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		oldSpans []diffSpan
+		newSpans []diffSpan
+	}{
+		{
+			name:     "changed word",
+			old:      "var a = 1",
+			new:      "var a = 10",
+			oldSpans: []diffSpan{{8, 9}},
+			newSpans: []diffSpan{{8, 10}},
+		},
+		{
+			name:     "inserted words",
+			old:      "f(a)",
+			new:      "f(a, b)",
+			oldSpans: nil,
+			newSpans: []diffSpan{{3, 6}},
+		},
+		{
+			name:     "several changes",
+			old:      "x := foo(1) + bar",
+			new:      "y := foo(2) + bar",
+			oldSpans: []diffSpan{{0, 1}, {9, 10}},
+			newSpans: []diffSpan{{0, 1}, {9, 10}},
+		},
+		{
+			name: "nothing in common but spaces",
+			old:  "return nil",
+			new:  "panic(err)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oldSpans, newSpans := changedRanges(tc.old, tc.new)
+			if !reflect.DeepEqual(oldSpans, tc.oldSpans) || !reflect.DeepEqual(newSpans, tc.newSpans) {
+				t.Errorf("expected %v and %v, got %v and %v", tc.oldSpans, tc.newSpans, oldSpans, newSpans)
+			}
+		})
+	}
+}
+
+func TestCommonEnds(t *testing.T) {
+	keepA, keepB := commonEnds([]string{"a", "b", "c", "d"}, []string{"a", "x", "d"})
+	if !reflect.DeepEqual(keepA, []bool{true, false, false, true}) || !reflect.DeepEqual(keepB, []bool{true, false, true}) {
+		t.Errorf("unexpected common ends %v and %v", keepA, keepB)
+	}
+}
+
+func TestChangedLinePairs(t *testing.T) {
+	lines := func(origins string) []diffLine {
+		var result []diffLine
+		for _, o := range []byte(origins) {
+			result = append(result, diffLine{Origin: o})
+		}
+		return result
+	}
+
+	tests := []struct {
+		origins  string
+		expected [][2]int
+	}{
+		{" --+ ", [][2]int{{1, 3}}},
+		{"-++-+", [][2]int{{0, 1}, {3, 4}}},
+		{"++ --", nil},
+	}
+
+	for _, tc := range tests {
+		if got := changedLinePairs(lines(tc.origins)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.origins, tc.expected, got)
+		}
+	}
+}
+
+func TestRenderDiffTokens(t *testing.T) {
+	tokens := []chroma.Token{
+		{Type: chroma.KeywordDeclaration, Value: "var"},
+		{Type: chroma.Text, Value: " a = "},
+		{Type: chroma.LiteralNumberInteger, Value: "10"},
+		{Type: chroma.Text, Value: " <"},
+	}
+
+	got := string(renderDiffTokens(tokens, nil))
+	expected := `<span class="kd">var</span> a = <span class="mi">10</span> &lt;`
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// the change starts within a token and spans the next
+	got = string(renderDiffTokens(tokens, []diffSpan{{6, 10}}))
+	expected = `<span class="kd">var</span> a <span class="diff-word">= </span><span class="mi diff-word">10</span> &lt;`
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestHighlightPatch(t *testing.T) {
+	patch := highlightPatch(fileDiff{NewPath: "main.go", Text: testPatch})
+
+	lines := patch.Hunks[0].Lines
+	if !strings.Contains(string(lines[0].HTML), `<span class="kn">package</span>`) {
+		t.Errorf("expected a highlighted context line, got %q", lines[0].HTML)
+	}
+	if !strings.Contains(string(lines[3].HTML), `diff-word">10</span>`) {
+		t.Errorf("expected the changed number to be marked, got %q", lines[3].HTML)
+	}
+	if strings.Contains(string(lines[2].HTML), "diff-word") {
+		t.Errorf("expected the unpaired removed line to have no marks, got %q", lines[2].HTML)
+	}
+
+	unified := unifiedLines(patch)
+	if !strings.HasPrefix(string(unified[6]), `<span class="diff-del">-`) {
+		t.Errorf("expected the first removed line in the unified view, got %q", unified[6])
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	files, additions, deletions := diffFiles([]fileDiff{
+		{OldPath: "main.go", NewPath: "main.go", Status: "modified", Text: testPatch},
+		{OldPath: "old.go", NewPath: "new.go", Status: "renamed", Similarity: 90,
+			Text: "diff --git a/old.go b/new.go\n@@ -1 +1 @@\n-a\n+b"},
+		{OldPath: "logo.png", NewPath: "logo.png", Status: "added", Binary: true},
+		{OldPath: "sub", NewPath: "sub", Status: "modified", Text: "diff --git a/sub b/sub\nSubproject commit a → b"},
+	})
+
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(files))
+	}
+	if additions != 4 || deletions != 4 {
+		t.Errorf("expected +4 -4 in total, got +%d -%d", additions, deletions)
+	}
+
+	type counts struct{ add, del, addBar, delBar int }
+	expected := []counts{{3, 3, 50, 50}, {1, 1, 16, 16}, {0, 0, 0, 0}, {0, 0, 0, 0}}
+	for i, file := range files {
+		got := counts{file.Additions, file.Deletions, file.AddBar, file.DelBar}
+		if got != expected[i] {
+			t.Errorf("%s: expected %+v, got %+v", file.NewPath, expected[i], got)
+		}
+	}
+
+	renamed := files[1]
+	if renamed.OldPath != "old.go" || renamed.Similarity != 90 || renamed.Anchor != diffAnchor("new.go") {
+		t.Errorf("unexpected renamed file %+v", renamed)
+	}
+	if files[2].Lines != nil || !files[2].Binary {
+		t.Errorf("expected the binary file without lines, got %+v", files[2])
+	}
+	if len(files[3].Hunks) != 0 || len(files[3].Header) != 2 || len(files[3].Lines) != 2 {
+		t.Errorf("expected the submodule change to be all header, got %+v", files[3])
+	}
+}
+
+func TestDiffAnchor(t *testing.T) {
+	anchor := diffAnchor("src/main.go")
+	if !strings.HasPrefix(anchor, "diff-") || len(anchor) != len("diff-")+16 {
+		t.Errorf("unexpected anchor %q", anchor)
+	}
+	if anchor != diffAnchor("src/main.go") || anchor == diffAnchor("src/util.go") {
+		t.Errorf("expected anchors to depend on the path only")
+	}
+}
+
+func TestLimitDiffs(t *testing.T) {
+	orig := Config
+	defer func() { Config = orig }()
+	Config.DiffMaxLines, Config.DiffMaxBytes, Config.DiffMaxFiles = 4, 100, 6
+
+	small := "diff --git a/f b/f\n@@ -1 +1 @@\n-a\n+b\n"
+	long := "diff --git a/f b/f\n@@ -1,3 +1,3 @@\n-a\n-b\n-c\n+d\n+e\n+f\n"
+	huge := small + strings.Repeat("+x\n", 50)
+	attrs := parseGitattributes([]byte("*.pb.go linguist-generated\nvendor/** linguist-vendored\n"))
+
+	diffs := []fileDiff{
+		{NewPath: "main.go", Text: small},
+		{NewPath: "api.pb.go", Text: small},
+		{NewPath: "vendor/lib.go", Text: small},
+		{NewPath: "long.go", Text: long},
+		{NewPath: "huge.go", Text: huge},
+		{NewPath: "logo.png", Binary: true},
+		{NewPath: "dropped.go", Text: small},
+	}
+
+	shown, dropped := limitDiffs(diffs[:6], attrs)
+	expected := []string{"", collapsedGenerated, collapsedVendored, collapsedLarge, collapsedTooLarge, ""}
+	for i, d := range shown {
+		if d.Collapsed != expected[i] {
+			t.Errorf("%s: expected %q, got %q", d.NewPath, expected[i], d.Collapsed)
+		}
+	}
+	if dropped != 0 {
+		t.Errorf("expected no dropped files, got %d", dropped)
+	}
+
+	shown, dropped = limitDiffs(diffs, nil)
+	if len(shown) != 6 || dropped != 1 {
+		t.Errorf("expected 6 files shown and 1 dropped, got %d and %d", len(shown), dropped)
+	}
+
+	// the total size collapses the files past it
+	var many []fileDiff
+	for i := 0; i < 4; i++ {
+		many = append(many, fileDiff{NewPath: "f.go", Text: small})
+	}
+	shown, _ = limitDiffs(many, nil)
+	if shown[1].Collapsed != "" || shown[2].Collapsed != collapsedLarge || shown[3].Collapsed != collapsedLarge {
+		t.Errorf("expected the files past %d bytes to be collapsed, got %+v", Config.DiffMaxBytes, shown)
+	}
+
+	Config.DiffMaxLines, Config.DiffMaxBytes, Config.DiffMaxFiles = 0, 0, 0
+	shown, dropped = limitDiffs(diffs, nil)
+	if len(shown) != len(diffs) || dropped != 0 || shown[4].Collapsed != "" {
+		t.Errorf("expected no limits, got %d files shown and %d dropped", len(shown), dropped)
+	}
+}
+
+func TestCountChanges(t *testing.T) {
+	additions, deletions := countChanges(testPatch)
+	patch := parsePatch(testPatch)
+	if additions != patch.Additions || deletions != patch.Deletions {
+		t.Errorf("expected +%d -%d, got +%d -%d", patch.Additions, patch.Deletions, additions, deletions)
+	}
+
+	// the --- and +++ lines of the header are not changes
+	additions, deletions = countChanges("--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+b\n")
+	if additions != 1 || deletions != 1 {
+		t.Errorf("expected +1 -1, got +%d -%d", additions, deletions)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// The feeds of a repository, relative to its directory
+const (
+	commitFeedName = "atom.xml"
+	tagFeedName    = "tags.xml"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	Id      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Author  atomPerson `xml:"author"`
+	Links   []atomLink `xml:"link"`
+	Content atomText   `xml:"content"`
+}
+
+// feedItem is a commit or a tag as listed in a feed
+type feedItem struct {
+	Title   string
+	Id      string // a URN naming the commit or the tag
+	Link    string // the page of the item, relative to the repository
+	Author  string
+	Email   string
+	Date    time.Time
+	Message string
+}
+
+// siteLink returns the link to a page of the repository for use outside of
+// the site, absolute when Config.BaseUrl is set, and otherwise relative to
+// the feeds at the root of the repository with relative links
+func siteLink(link string) string {
+	if Config.BaseUrl == "" && Config.RelativeLinks {
+		return strings.TrimPrefix(link, "/")
+	}
+	return strings.TrimSuffix(Config.BaseUrl, "/") + "/" + Config.RepoName + link
+}
+
+// atomTime formats t as an Atom date
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newAtomFeed returns the feed at name, relative to the repository, listing
+// items, newest first, and linking the page at alternate
+// The feed is as recent as its newest item
+func newAtomFeed(title, name, alternate string, items []feedItem) atomFeed {
+	feed := atomFeed{
+		Title: title,
+		Id:    siteLink("/" + name),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: siteLink("/" + name)},
+			{Rel: "alternate", Type: "text/html", Href: siteLink(alternate)},
+		},
+	}
+	for _, item := range items {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   item.Title,
+			Id:      item.Id,
+			Updated: atomTime(item.Date),
+			Author:  atomPerson{Name: item.Author, Email: item.Email},
+			Links:   []atomLink{{Rel: "alternate", Type: "text/html", Href: siteLink(item.Link)}},
+			Content: atomText{Type: "text", Body: item.Message},
+		})
+	}
+	if len(items) > 0 {
+		feed.Updated = atomTime(items[0].Date)
+	} else {
+		feed.Updated = atomTime(time.Unix(0, 0))
+	}
+	return feed
+}
+
+// writeFeed writes feed to name in the destination directory
+func writeFeed(name string, feed atomFeed) error {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(filepath.Join(Config.DestDir, name), append(data, '\n'), 0644)
+}
+
+// feedLimit returns the first Config.FeedEntries of items, or all of them
+// when the limit is zero
+func feedLimit(items []feedItem) []feedItem {
+	if Config.FeedEntries > 0 && len(items) > Config.FeedEntries {
+		return items[:Config.FeedEntries]
+	}
+	return items
+}
+
+// writeCommitFeed writes the feed of the newest commits of the log of the
+// branch branchName
+func writeCommitFeed(repo *git.Repository, branchName string, commitlist []CommitListElem) error {
+	var items []feedItem
+	for _, elem := range commitlist {
+		if Config.FeedEntries > 0 && len(items) == Config.FeedEntries {
+			break
+		}
+		id, err := git.NewOid(elem.Hash)
+		if err != nil {
+			return err
+		}
+		commit, err := repo.LookupCommit(id)
+		if err != nil {
+			return err
+		}
+		author := commit.Author()
+		items = append(items, feedItem{
+			Title:   commit.Summary(),
+			Id:      "urn:git:commit:" + elem.Hash,
+			Link:    elem.Link,
+			Author:  author.Name,
+			Email:   author.Email,
+			Date:    author.When,
+			Message: strings.TrimRight(commit.Message(), "\n"),
+		})
+		commit.Free()
+	}
+
+	feed := newAtomFeed(Config.RepoName+", "+branchName, commitFeedName, "/log/"+branchName+"/index.html", items)
+	return writeFeed(commitFeedName, feed)
+}
+
+// writeTagFeed writes the feed of the newest tags, dated and signed by their
+// tagger, or by the author of their commit for lightweight tags
+func writeTagFeed(repo *git.Repository, tags []RefListElem) error {
+	var items []feedItem
+	for _, ref := range tags {
+		item, err := tagFeedItem(repo, ref)
+		if err != nil {
+			GlobalWarnings.add(ref.RefName, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Date.After(items[j].Date)
+	})
+
+	feed := newAtomFeed(Config.RepoName+", tags", tagFeedName, "/tags.html", feedLimit(items))
+	return writeFeed(tagFeedName, feed)
+}
+
+// tagFeedItem returns the feed item of the tag ref, linking the page of the
+// commit it points to, through any nested tags, or the tags page if the
+// commit has none
+func tagFeedItem(repo *git.Repository, ref RefListElem) (feedItem, error) {
+	reference, err := repo.References.Lookup(ref.RefName)
+	if err != nil {
+		return feedItem{}, err
+	}
+	defer reference.Free()
+	obj, err := reference.Peel(git.ObjectCommit)
+	if err != nil {
+		return feedItem{}, err
+	}
+	defer obj.Free()
+	commit, err := obj.AsCommit()
+	if err != nil {
+		return feedItem{}, err
+	}
+	defer commit.Free()
+
+	link := "/tags.html"
+	if _, ok := GlobalManifest.Commits[commit.Id().String()]; ok {
+		link = "/commit/" + commit.Id().String() + ".html"
+	}
+	author := commit.Author()
+	item := feedItem{
+		Title:   ref.Name,
+		Id:      "urn:git:tag:" + ref.Name,
+		Link:    link,
+		Author:  author.Name,
+		Email:   author.Email,
+		Date:    author.When,
+		Message: strings.TrimRight(commit.Message(), "\n"),
+	}
+
+	tag, err := repo.LookupTag(reference.Target())
+	if err != nil {
+		// a lightweight tag
+		return item, nil
+	}
+	defer tag.Free()
+
+	if tagger := tag.Tagger(); tagger != nil {
+		item.Author, item.Email, item.Date = tagger.Name, tagger.Email, tagger.When
+	}
+	if message := strings.TrimRight(tag.Message(), "\n"); message != "" {
+		item.Message = message
+	}
+	return item, nil
+}
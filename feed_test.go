@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteLink(t *testing.T) {
+	orig := Config
+	defer func() { Config = orig }()
+	Config.RepoName = "gitgo"
+
+	tests := []struct {
+		baseUrl  string
+		relative bool
+		expected string
+	}{
+		{"", false, "/gitgo/atom.xml"},
+		{"https://git.example.com", false, "https://git.example.com/gitgo/atom.xml"},
+		{"https://example.com/code/", false, "https://example.com/code/gitgo/atom.xml"},
+		{"", true, "atom.xml"},
+		{"https://example.com/code/", true, "https://example.com/code/gitgo/atom.xml"},
+	}
+
+	for _, tc := range tests {
+		Config.BaseUrl, Config.RelativeLinks = tc.baseUrl, tc.relative
+		if got := siteLink("/atom.xml"); got != tc.expected {
+			t.Errorf("siteLink with base %q, relative %v: expected %q, got %q", tc.baseUrl, tc.relative, tc.expected, got)
+		}
+	}
+}
+
+func TestNewAtomFeed(t *testing.T) {
+	orig := Config
+	defer func() { Config = orig }()
+	Config.RepoName, Config.BaseUrl = "gitgo", "https://git.example.com"
+
+	newer := time.Date(2024, 3, 2, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	items := []feedItem{
+		{Title: "Fix <html> escaping", Id: "urn:git:commit:2", Link: "/commit/2.html",
+			Author: "Jane", Email: "jane@example.com", Date: newer, Message: "Fix <html> escaping\n\nDetails & more"},
+		{Title: "Initial commit", Id: "urn:git:commit:1", Link: "/commit/1.html",
+			Author: "Jane", Date: newer.Add(-time.Hour)},
+	}
+
+	feed := newAtomFeed("gitgo, main", "atom.xml", "/log/main", items)
+	if feed.Updated != "2024-03-02T11:00:00Z" {
+		t.Errorf("expected the feed to be as recent as its newest entry, got %s", feed.Updated)
+	}
+	if feed.Links[0].Href != "https://git.example.com/gitgo/atom.xml" || feed.Links[1].Href != "https://git.example.com/gitgo/log/main" {
+		t.Errorf("unexpected feed links %+v", feed.Links)
+	}
+
+	data, err := xml.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal feed: %v", err)
+	}
+	out := string(data)
+	for _, expected := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<title>Fix &lt;html&gt; escaping</title>`,
+		`<author><name>Jane</name><email>jane@example.com</email></author>`,
+		`<link rel="alternate" type="text/html" href="https://git.example.com/gitgo/commit/2.html"></link>`,
+		`<content type="text">Fix &lt;html&gt; escaping&#xA;&#xA;Details &amp; more</content>`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s in %s", expected, out)
+		}
+	}
+	if strings.Contains(out, "<email></email>") {
+		t.Errorf("expected no email for entries without one")
+	}
+
+	empty := newAtomFeed("gitgo, tags", "tags.xml", "/tags.html", nil)
+	if empty.Updated == "" || len(empty.Entries) != 0 {
+		t.Errorf("expected an empty feed with a date, got %+v", empty)
+	}
+}
+
+func TestFeedLimit(t *testing.T) {
+	orig := Config.FeedEntries
+	defer func() { Config.FeedEntries = orig }()
+
+	items := make([]feedItem, 5)
+	Config.FeedEntries = 2
+	if got := len(feedLimit(items)); got != 2 {
+		t.Errorf("expected 2 items, got %d", got)
+	}
+	Config.FeedEntries = 0
+	if got := len(feedLimit(items)); got != 5 {
+		t.Errorf("expected all 5 items without a limit, got %d", got)
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -12,459 +12,719 @@ import (
 	git "github.com/libgit2/git2go/v34"
 )
 
-func getCommitLog(repo *git.Repository, head *git.Oid) []CommitListElem {
+func getCommitLog(repo *git.Repository, head *git.Oid) ([]CommitListElem, error) {
 	var commitlist []CommitListElem
 
+	// Render jobs read a snapshot of the global data, never the global itself
+	global := GlobalDataGlobal
+	pool := newRenderPool(Config.Jobs)
+	defer pool.Wait()
+
 	walk, err := repo.Walk()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	if err = walk.Push(head); err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if Config.AllParents {
+		// children before their parents, so that the graph can be drawn
+		walk.Sorting(git.SortTopological | git.SortTime)
+	} else {
+		walk.SimplifyFirstParent()
 	}
-	walk.SimplifyFirstParent()
 
+	// the whole log first, so that every commit page can link its neighbours
+	var ids []git.Oid
 	id := git.Oid{}
+	for walk.Next(&id) == nil {
+		ids = append(ids, id)
+	}
 
-	for {
-		if err = walk.Next(&id); err != nil {
-			// at the end of the commit history
-			break
-		}
-
-		commit, err := repo.LookupCommit(&id)
+	for i := range ids {
+		commit, err := repo.LookupCommit(&ids[i])
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 
-		var parents []string
-
-		parentcount := int(commit.ParentCount())
-		parentcountispositive := parentcount > 0
+		commitId := commit.Id().String()
+		page := filepath.Join("commit", commitId+".html")
+		// the logs of several refs share commits; render each page once
+		_, rendered := GlobalManifest.Commits[commitId]
+		GlobalManifest.Commits[commitId] = page
 
-		for i := 0; i < parentcount; i++ {
-			parents = append(parents, commit.Parent(uint(i)).TreeId().String())
+		nav := CommitNav{
+			ContainedIn: GlobalRefIndex.containing(commitId),
+			Describe:    GlobalRefIndex.describe(commitId),
+		}
+		if i > 0 {
+			nav.PrevLink = "/" + filepath.Join("commit", ids[i-1].String()+".html")
+		}
+		if i+1 < len(ids) {
+			nav.NextLink = "/" + filepath.Join("commit", ids[i+1].String()+".html")
+		}
+		pageEntry := ManifestEntry{Object: commitId, Nav: hashCommitNav(nav)}
+		if !rendered {
+			GlobalManifest.Files[page] = pageEntry
 		}
 
-		var diffstat = ""
-
-		if parentcountispositive {
-			opts, err := git.DefaultDiffOptions()
+		upToDate := commitUpToDate(commitId, page) && pageUpToDate(page, pageEntry)
+		for _, extraPage := range commitExtraPages(page, int(commit.ParentCount())) {
+			extraEntry := ManifestEntry{Object: commitId}
+			GlobalManifest.Files[extraPage] = extraEntry
+			upToDate = upToDate && pageUpToDate(extraPage, extraEntry)
+		}
+		if !rendered && !upToDate {
+			err = writeCommitPage(repo, commit, page, nav, &global, pool)
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
 			}
-			opts.Flags |= git.DiffDisablePathspecMatch | git.DiffIgnoreSubmodules | git.DiffIncludeTypeChange
+		} else if !rendered {
+			GlobalManifest.keepCommitAssets(GlobalPrevManifest, commitId)
+		}
 
-			parenttree, err := commit.Parent(0).Tree()
-			if err != nil {
-				log.Fatal(err)
-			}
-			tree, err := commit.Tree()
+		// Pages used to be named by tree ID; keep links to them working
+		if Config.TreeIdRedirects && !rendered {
+			writeTreeIdRedirect(commit, "/"+page, &global, pool)
+		}
+
+		if Config.CommitTrees && !rendered {
+			err = indexCommitTree(repo, commit, commitUpToDate(commitId, page))
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
 			}
+		}
 
-			diff, err := repo.DiffTreeToTree(parenttree, tree, &opts)
-			if err != nil {
-				log.Fatal(err)
+		commitlist = append(commitlist, newCommitListElem(commit))
+	}
+
+	if err := pool.Wait(); err != nil {
+		return nil, err
+	}
+	if Config.AllParents {
+		layoutGraph(commitlist)
+	}
+	return commitlist, nil
+}
+
+// commitHasPage reports whether the commit id gets a page: every commit does
+// with Config.AllParents, otherwise only those of the first parent history
+// of a log, as far as the logs walked so far tell
+func commitHasPage(id string) bool {
+	if Config.AllParents {
+		return true
+	}
+	_, ok := GlobalManifest.Commits[id]
+	return ok
+}
+
+// newCommitListElem returns the log entry of commit, whose summary is
+// shortened to Config.MaxSummaryLen
+func newCommitListElem(commit *git.Commit) CommitListElem {
+	commitId := commit.Id().String()
+
+	msg := commit.Summary()
+	if len(msg) > Config.MaxSummaryLen {
+		msg = msg[:Config.MaxSummaryLen-3] + "..."
+	}
+
+	parents := make([]string, commit.ParentCount())
+	for i := range parents {
+		parents[i] = commit.ParentId(uint(i)).String()
+	}
+
+	return CommitListElem{
+		Link:       filepath.Join("/commit", commitId+".html"),
+		Msg:        msg,
+		Name:       commit.Author().Name,
+		Date:       commit.Author().When,
+		AbbrevHash: commitId[:8],
+		Hash:       commitId,
+		Parents:    parents,
+	}
+}
+
+// writeCommitPage computes the diff of a single commit against its first
+// parent, and of merges against every other parent, and submits the
+// rendering of its pages, showing nav, to the pool
+func writeCommitPage(repo *git.Repository, commit *git.Commit, page string, nav CommitNav, global *GlobalRenderData, pool *renderPool) error {
+	var parents []string
+
+	parentcount := int(commit.ParentCount())
+	parentcountispositive := parentcount > 0
+
+	for i := 0; i < parentcount; i++ {
+		parents = append(parents, commit.ParentId(uint(i)).String())
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	attrs := readGitattributes(repo, tree)
+	commitId := commit.Id().String()
+
+	// root commits are diffed against the empty tree
+	diff, err := diffCommit(repo, commit, 0, tree)
+	if err != nil {
+		return err
+	}
+	rawdiff, err := diff.ToBuf(git.DiffFormatPatch)
+	if err != nil {
+		return err
+	}
+
+	// every changed file with its diff
+	patches, err := commitFileDiffs(repo, diff, commitId)
+	if err != nil {
+		return err
+	}
+	patches, dropped := limitDiffs(patches, attrs)
+	linkCollapsedDiffs(patches, page, commitId)
+
+	data := CommitRenderData{GlobalData: global,
+		Author:        commit.Author().Name,
+		Mail:          commit.Author().Email,
+		Date:          commit.Author().When,
+		Id:            commitId,
+		HasAnyParents: parentcountispositive,
+		MsgLines:      strings.Split(strings.TrimRight(commit.Message(), "\n"), "\n"),
+		DroppedFiles:  dropped,
+		Nav:           nav}
+	for i, parent := range parents {
+		elem := CommitParent{Hash: parent}
+		// the first parent is next in the log, whose pages are not all recorded yet
+		if i == 0 || commitHasPage(parent) {
+			elem.Link = "/commit/" + parent + ".html"
+		}
+		data.Parents = append(data.Parents, elem)
+	}
+	if Config.CommitTrees {
+		data.TreeLink = commitTreeRoot(data.Id)
+	}
+	base := strings.TrimSuffix(page, ".html")
+	data.PatchLink, data.DiffLink = "/"+base+".patch", "/"+base+".diff"
+
+	// merges get a page of the diff against each of their other parents
+	type parentView struct {
+		page    string
+		patches []fileDiff
+		dropped int
+	}
+	var parentViews []parentView
+	if parentcount > 1 {
+		data.Merged, data.MergedCount, err = mergedCommits(repo, commit)
+		if err != nil {
+			return err
+		}
+		for i := range data.Merged {
+			if !commitHasPage(data.Merged[i].Hash) {
+				data.Merged[i].Link = ""
 			}
-			fopts, err := git.DefaultDiffFindOptions()
+		}
+		for i := 0; i < parentcount; i++ {
+			data.ParentDiffs = append(data.ParentDiffs, ParentDiff{Number: i + 1, Hash: parents[i],
+				Link: "/" + parentDiffPage(page, i)})
+		}
+		for i := 1; i < parentcount; i++ {
+			diff, err := diffCommit(repo, commit, i, tree)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
-			fopts.Flags |= git.DiffFindRenames | git.DiffFindCopies | git.DiffFindExactMatchOnly
-			err = diff.FindSimilar(&fopts)
+			view := parentView{page: parentDiffPage(page, i)}
+			view.patches, err = commitFileDiffs(repo, diff, commitId)
 			if err != nil {
-				log.Fatal(err)
-			}
-			numdeltas, err := diff.NumDeltas()
-
-			for i := 0; i < numdeltas; i++ {
-				delta, err := diff.GetDelta(i)
-				if err != nil {
-					log.Fatal(err)
-				}
-				patch, err := diff.Patch(i)
-				if err != nil {
-					log.Fatal(err)
-				}
-				if (delta.Flags & git.DiffFlagBinary) > 0 {
-					continue
-				}
-				str, err := patch.String()
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				diffstat += str + "\n"
+				return err
 			}
+			view.patches, view.dropped = limitDiffs(view.patches, attrs)
+			linkCollapsedDiffs(view.patches, view.page, commitId)
+			parentViews = append(parentViews, view)
 		}
+	}
 
-		commitfilename := filepath.Join(Config.DestDir, "commit", commit.TreeId().String()+".html")
-		commitfile, err := os.Create(commitfilename)
+	author := commit.Author()
+	message := commit.Message()
+	pool.Go(func() error {
+		email := formatPatchEmail(data.Id, author.Name, author.Email, author.When, message, string(rawdiff))
+		err := os.WriteFile(filepath.Join(Config.DestDir, base+".patch"), []byte(email), 0644)
 		if err != nil {
-			log.Fatal(err)
-		}
-		err = t.ExecuteTemplate(commitfile, "commit.html", CommitRenderData{GlobalData: &GlobalDataGlobal,
-			Author:        commit.Author().Name,
-			Mail:          commit.Author().Email,
-			Date:          commit.Author().When,
-			Id:            commit.TreeId().String(),
-			Parents:       parents,
-			HasAnyParents: parentcountispositive,
-			MsgLines:      strings.Split(strings.TrimRight(commit.Message(), "\n"), "\n"),
-			DiffStatLines: highlightDiffLines(diffstat)})
-
+			return err
+		}
+		err = os.WriteFile(filepath.Join(Config.DestDir, base+".diff"), rawdiff, 0644)
 		if err != nil {
-			log.Print("execute:", err)
+			return err
 		}
-		commitfile.Sync()
-		defer commitfile.Close()
 
-		link := filepath.Join("/commit", commit.TreeId().String()+".html")
-		msg := commit.Summary()
-		if len(msg) > Config.MaxSummaryLen {
-			msg = msg[:Config.MaxSummaryLen-3] + "..."
+		first := data
+		first.ParentDiffs = currentParentDiff(data.ParentDiffs, 0)
+		err = writeCollapsedDiffs(page, first, patches)
+		if err != nil {
+			return err
 		}
+		first.Files, first.Additions, first.Deletions = diffFiles(patches)
 
-		name := commit.Author().Name
-		date := commit.Author().When
-		abbrevHash := commit.TreeId().String()[:8]
+		for i, view := range parentViews {
+			other := data
+			other.ParentDiffs = currentParentDiff(data.ParentDiffs, i+1)
+			other.DroppedFiles = view.dropped
+			err = writeCollapsedDiffs(view.page, other, view.patches)
+			if err != nil {
+				return err
+			}
+			other.Files, other.Additions, other.Deletions = diffFiles(view.patches)
+			err = writeCommitView(view.page, other)
+			if err != nil {
+				return err
+			}
+		}
 
-		commitlist = append(commitlist, CommitListElem{
-			Link:       link,
-			Msg:        msg,
-			Name:       name,
-			Date:       date,
-			AbbrevHash: abbrevHash,
-		})
-	}
+		unified := first
+		if Config.SplitDiffs {
+			unified.SplitLink = "/" + splitDiffPage(page)
+		}
+		err = writeCommitView(page, unified)
+		if err != nil || !Config.SplitDiffs {
+			return err
+		}
 
-	return commitlist
+		split := first
+		split.Split = true
+		split.UnifiedLink = "/" + page
+		return writeCommitView(splitDiffPage(page), split)
+	})
+	return nil
 }
 
-// getLastModifiedDate returns the date of the last commit that modified the given path
-func getLastModifiedDate(repo *git.Repository, repoPath string) time.Time {
-	head, err := repo.Head()
+// diffCommit returns the diff of commit against its parent n, or against the
+// empty tree for root commits, with renames and copies found
+// Binary changes are left out of the page but kept in the patch files
+func diffCommit(repo *git.Repository, commit *git.Commit, n int, tree *git.Tree) (*git.Diff, error) {
+	opts, err := git.DefaultDiffOptions()
 	if err != nil {
-		return time.Time{}
+		return nil, err
 	}
-	defer head.Free()
+	opts.Flags |= git.DiffDisablePathspecMatch | git.DiffIncludeTypeChange | git.DiffShowBinary
 
-	walk, err := repo.Walk()
-	if err != nil {
-		return time.Time{}
+	var parenttree *git.Tree
+	if commit.ParentCount() > uint(n) {
+		parenttree, err = commit.Parent(uint(n)).Tree()
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer walk.Free()
 
-	if err = walk.Push(head.Target()); err != nil {
-		return time.Time{}
+	diff, err := repo.DiffTreeToTree(parenttree, tree, &opts)
+	if err != nil {
+		return nil, err
 	}
-
-	// Remove leading /tree from path for pathspec
-	cleanPath := strings.TrimPrefix(repoPath, "/tree/")
-	if cleanPath == "/tree" {
-		cleanPath = ""
+	fopts, err := git.DefaultDiffFindOptions()
+	if err != nil {
+		return nil, err
+	}
+	fopts.Flags |= git.DiffFindRenames | git.DiffFindCopies
+	err = diff.FindSimilar(&fopts)
+	if err != nil {
+		return nil, err
 	}
+	return diff, nil
+}
 
-	walk.SimplifyFirstParent()
+// commitFileDiffs returns every file changed by diff with its diff, and
+// writes the images it changes as assets of the page of commit commitId
+func commitFileDiffs(repo *git.Repository, diff *git.Diff, commitId string) ([]fileDiff, error) {
+	var patches []fileDiff
 
-	id := git.Oid{}
-	for {
-		if err = walk.Next(&id); err != nil {
-			break
-		}
+	numdeltas, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
+	}
 
-		commit, err := repo.LookupCommit(&id)
+	for i := 0; i < numdeltas; i++ {
+		delta, err := diff.GetDelta(i)
 		if err != nil {
+			return nil, err
+		}
+		file := newFileDiff(delta)
+		if isSubmoduleDelta(delta) {
+			file.Text = submoduleDiff(delta)
+			patches = append(patches, file)
 			continue
 		}
-
-		tree, err := commit.Tree()
+		if isImageFile(file.NewPath) {
+			file.OldImage, file.NewImage = writeDiffImages(repo, delta, commitId)
+		}
+		patch, err := diff.Patch(i)
 		if err != nil {
-			commit.Free()
+			return nil, err
+		}
+		if (delta.Flags & git.DiffFlagBinary) > 0 {
+			file.Binary = true
+			file.OldSize = blobSize(repo, delta.OldFile)
+			file.NewSize = blobSize(repo, delta.NewFile)
+			patches = append(patches, file)
 			continue
 		}
-
-		// For the root tree, return the commit date
-		if cleanPath == "" {
-			date := commit.Author().When
-			tree.Free()
-			commit.Free()
-			return date
+		file.Text, err = patch.String()
+		if err != nil {
+			return nil, err
 		}
 
-		// Check if this path exists in this commit
-		_, err = tree.EntryByPath(cleanPath)
-		tree.Free()
-
-		if err == nil {
-			// Path exists in this commit, check if it was modified
-			if commit.ParentCount() == 0 {
-				// Initial commit
-				date := commit.Author().When
-				commit.Free()
-				return date
-			}
-
-			parent := commit.Parent(0)
-			if parent == nil {
-				date := commit.Author().When
-				commit.Free()
-				return date
-			}
-
-			parentTree, err := parent.Tree()
-			if err != nil {
-				parent.Free()
-				date := commit.Author().When
-				commit.Free()
-				return date
-			}
-
-			// Check if path exists in parent
-			_, err = parentTree.EntryByPath(cleanPath)
-			parentTree.Free()
-			parent.Free()
+		patches = append(patches, file)
+	}
+	return patches, nil
+}
 
-			if err != nil {
-				// Path didn't exist in parent, so it was added in this commit
-				date := commit.Author().When
-				commit.Free()
-				return date
-			}
+// linkCollapsedDiffs links the collapsed diffs of the commit page at page to
+// pages of their own and records those as written along with it
+func linkCollapsedDiffs(patches []fileDiff, page, commitId string) {
+	for i := range patches {
+		if patches[i].Collapsed == "" || patches[i].Collapsed == collapsedTooLarge {
+			continue
+		}
+		filePage := diffFilePage(page, patches[i].NewPath)
+		GlobalManifest.Files[filePage] = ManifestEntry{Object: commitId}
+		GlobalManifest.CommitAssets[commitId] = append(GlobalManifest.CommitAssets[commitId], filePage)
+		patches[i].Link = "/" + filePage
+	}
+}
 
-			// For directories and files, we need to check if content changed
-			// For simplicity, we'll use the commit where the path first appears or changes
-			opts, err := git.DefaultDiffOptions()
+// writeCollapsedDiffs writes the linked collapsed diffs of the commit page
+// at page on pages of their own, in the unified view
+func writeCollapsedDiffs(page string, data CommitRenderData, patches []fileDiff) error {
+	dirMade := false
+	for _, d := range patches {
+		if d.Link == "" {
+			continue
+		}
+		if !dirMade {
+			err := makeDir(filepath.Join(Config.DestDir, strings.TrimSuffix(page, ".html")))
 			if err != nil {
-				commit.Free()
-				continue
+				return err
 			}
+			dirMade = true
+		}
+		filePage := strings.TrimPrefix(d.Link, "/")
+		d.Collapsed, d.Link = "", ""
+		single := data
+		single.CommitLink = "/" + page
+		single.DroppedFiles = 0
+		single.Files, single.Additions, single.Deletions = diffFiles([]fileDiff{d})
+		err := writeCommitView(filePage, single)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			parentCommit := commit.Parent(0)
-			if parentCommit == nil {
-				date := commit.Author().When
-				commit.Free()
-				return date
-			}
+// maxMergedCommits is the most commits listed as brought in by a merge
+const maxMergedCommits = 100
 
-			currentTree, _ := commit.Tree()
-			parentTree2, _ := parentCommit.Tree()
+// mergedCommits returns the commits that merge brought in, those reachable
+// from its other parents but not from its first, newest first, along with
+// their number; at most maxMergedCommits of them are returned
+func mergedCommits(repo *git.Repository, merge *git.Commit) ([]CommitListElem, int, error) {
+	walk, err := repo.Walk()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer walk.Free()
+	walk.Sorting(git.SortTopological | git.SortTime)
 
-			if currentTree != nil && parentTree2 != nil {
-				opts.Pathspec = []string{cleanPath}
-				diff, err := repo.DiffTreeToTree(parentTree2, currentTree, &opts)
+	for i := uint(1); i < merge.ParentCount(); i++ {
+		if err = walk.Push(merge.ParentId(i)); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err = walk.Hide(merge.ParentId(0)); err != nil {
+		return nil, 0, err
+	}
 
-				if currentTree != nil {
-					currentTree.Free()
-				}
-				if parentTree2 != nil {
-					parentTree2.Free()
-				}
-				parentCommit.Free()
-
-				if err == nil {
-					numDeltas, _ := diff.NumDeltas()
-					diff.Free()
-
-					if numDeltas > 0 {
-						// This commit modified the path
-						date := commit.Author().When
-						commit.Free()
-						return date
-					}
-				} else {
-					if diff != nil {
-						diff.Free()
-					}
-				}
-			} else {
-				if currentTree != nil {
-					currentTree.Free()
-				}
-				if parentTree2 != nil {
-					parentTree2.Free()
-				}
-				parentCommit.Free()
-			}
+	var merged []CommitListElem
+	count := 0
+	id := git.Oid{}
+	for walk.Next(&id) == nil {
+		count++
+		if len(merged) == maxMergedCommits {
+			continue
+		}
+		commit, err := repo.LookupCommit(&id)
+		if err != nil {
+			return nil, 0, err
 		}
+		merged = append(merged, newCommitListElem(commit))
 		commit.Free()
 	}
-
-	return time.Time{}
+	return merged, count, nil
 }
 
-// getLastCommitInfo returns the date, message, link, and author name of the last commit that modified the given path
-func getLastCommitInfo(repo *git.Repository, repoPath string) (time.Time, string, string, string) {
-	head, err := repo.Head()
-	if err != nil {
-		return time.Time{}, "", "", ""
+// currentParentDiff returns a copy of the parent diffs of a merge with the
+// diff against parent n, counted from zero, marked as the current one
+func currentParentDiff(diffs []ParentDiff, n int) []ParentDiff {
+	if diffs == nil {
+		return nil
 	}
-	defer head.Free()
+	marked := make([]ParentDiff, len(diffs))
+	copy(marked, diffs)
+	marked[n].Current = true
+	return marked
+}
 
-	walk, err := repo.Walk()
-	if err != nil {
-		return time.Time{}, "", "", ""
+// parentDiffPage returns the page of the diff of a merge against its parent
+// n, counted from zero, next to the commit page at page; the diff against
+// the first parent is the commit page itself
+func parentDiffPage(page string, n int) string {
+	if n == 0 {
+		return page
 	}
-	defer walk.Free()
+	return fmt.Sprintf("%s.parent%d.html", strings.TrimSuffix(page, ".html"), n+1)
+}
 
-	if err = walk.Push(head.Target()); err != nil {
-		return time.Time{}, "", "", ""
+// newFileDiff returns the file changed by delta, without its diff
+func newFileDiff(delta git.DiffDelta) fileDiff {
+	file := fileDiff{OldPath: delta.OldFile.Path, NewPath: delta.NewFile.Path}
+	switch delta.Status {
+	case git.DeltaAdded:
+		file.Status = "added"
+	case git.DeltaDeleted:
+		file.Status = "deleted"
+	case git.DeltaRenamed:
+		file.Status = "renamed"
+		file.Similarity = int(delta.Similarity)
+	case git.DeltaCopied:
+		file.Status = "copied"
+		file.Similarity = int(delta.Similarity)
+	case git.DeltaTypeChange:
+		file.Status = "typechange"
+	default:
+		file.Status = "modified"
 	}
+	return file
+}
 
-	// Remove leading /tree from path for pathspec
-	cleanPath := strings.TrimPrefix(repoPath, "/tree/")
-	if cleanPath == "/tree" {
-		cleanPath = ""
+// blobSize returns the size of one side of a delta, or zero for the missing
+// side of added and deleted files
+func blobSize(repo *git.Repository, file git.DiffFile) int {
+	if file.Size > 0 || file.Oid == nil || file.Oid.IsZero() {
+		return file.Size
 	}
+	blob, err := repo.LookupBlob(file.Oid)
+	if err != nil {
+		return 0
+	}
+	defer blob.Free()
+	return int(blob.Size())
+}
 
-	walk.SimplifyFirstParent()
+// writeDiffImages writes both sides of a changed image as assets and returns
+// the links to them, empty for the missing side of added and deleted images
+// and for sides that could not be read
+func writeDiffImages(repo *git.Repository, delta git.DiffDelta, commitId string) (oldLink, newLink string) {
+	if delta.Status != git.DeltaAdded {
+		oldLink = writeBlobAsset(repo, delta.OldFile, commitId)
+	}
+	if delta.Status != git.DeltaDeleted {
+		newLink = writeBlobAsset(repo, delta.NewFile, commitId)
+	}
+	return oldLink, newLink
+}
 
-	id := git.Oid{}
-	for {
-		if err = walk.Next(&id); err != nil {
-			break
-		}
+// writeBlobAsset writes the blob of file to assets/blobs/, named by its ID
+// with the extension of its path so that it is served with the right type,
+// and returns the link to it
+// The asset is recorded as shown by the page of commit commitId, and written
+// once however many commits show it
+func writeBlobAsset(repo *git.Repository, file git.DiffFile, commitId string) string {
+	if file.Oid == nil || file.Oid.IsZero() {
+		return ""
+	}
+	id := file.Oid.String()
+	page := path.Join("assets", "blobs", id+strings.ToLower(path.Ext(file.Path)))
 
-		commit, err := repo.LookupCommit(&id)
+	entry := ManifestEntry{Object: id}
+	if _, written := GlobalManifest.Files[page]; !written && !pageUpToDate(page, entry) {
+		blob, err := repo.LookupBlob(file.Oid)
 		if err != nil {
-			continue
+			GlobalWarnings.add(page, err)
+			return ""
 		}
+		defer blob.Free()
 
-		tree, err := commit.Tree()
+		err = makeDir(filepath.Join(Config.DestDir, "assets", "blobs"))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(Config.DestDir, page), blob.Contents(), 0644)
+		}
 		if err != nil {
-			commit.Free()
-			continue
+			GlobalWarnings.add(page, err)
+			return ""
 		}
+	}
 
-		// For the root tree, return the commit info
-		if cleanPath == "" {
-			date := commit.Author().When
-			msg := commit.Summary()
-			link := "/commit/" + commit.TreeId().String() + ".html"
-			author := commit.Author().Name
-			tree.Free()
-			commit.Free()
-			return date, msg, link, author
-		}
+	GlobalManifest.Files[page] = entry
+	GlobalManifest.CommitAssets[commitId] = append(GlobalManifest.CommitAssets[commitId], page)
+	return "/" + page
+}
+
+// writeCommitView executes the commit template into page, one of the views
+// of the diff of a commit
+func writeCommitView(page string, data CommitRenderData) error {
+	commitfile, err := os.Create(filepath.Join(Config.DestDir, page))
+	if err != nil {
+		return err
+	}
+	defer commitfile.Close()
 
-		// Check if this path exists in this commit
-		_, err = tree.EntryByPath(cleanPath)
-		tree.Free()
+	data.GlobalData = data.GlobalData.atPage(page)
+	err = t.ExecuteTemplate(commitfile, "commit.html", data)
+	if err != nil {
+		GlobalWarnings.add(page, err)
+	}
+	return commitfile.Sync()
+}
 
-		if err == nil {
-			// Path exists in this commit, check if it was modified
-			if commit.ParentCount() == 0 {
-				// Initial commit
-				date := commit.Author().When
-				msg := commit.Summary()
-				link := "/commit/" + commit.TreeId().String() + ".html"
-				author := commit.Author().Name
-				commit.Free()
-				return date, msg, link, author
-			}
+// splitDiffPage returns the page of the side by side view next to the
+// commit page at page
+func splitDiffPage(page string) string {
+	return strings.TrimSuffix(page, ".html") + ".split.html"
+}
 
-			parent := commit.Parent(0)
-			if parent == nil {
-				date := commit.Author().When
-				msg := commit.Summary()
-				link := "/commit/" + commit.TreeId().String() + ".html"
-				author := commit.Author().Name
-				commit.Free()
-				return date, msg, link, author
-			}
+// diffFilePage returns the page of the collapsed diff of the file at path
+// next to the commit page at page
+func diffFilePage(page, path string) string {
+	return filepath.Join(strings.TrimSuffix(page, ".html"), diffAnchor(path)+".html")
+}
 
-			parentTree, err := parent.Tree()
-			if err != nil {
-				parent.Free()
-				date := commit.Author().When
-				msg := commit.Summary()
-				link := "/commit/" + commit.TreeId().String() + ".html"
-				author := commit.Author().Name
-				commit.Free()
-				return date, msg, link, author
-			}
+// commitExtraPages returns the files written next to the commit page at
+// page: the patch email, the plain diff, if enabled the side by side view,
+// and for merges the diffs against the other parents
+func commitExtraPages(page string, parentCount int) []string {
+	base := strings.TrimSuffix(page, ".html")
+	pages := []string{base + ".patch", base + ".diff"}
+	if Config.SplitDiffs {
+		pages = append(pages, splitDiffPage(page))
+	}
+	for n := 1; n < parentCount; n++ {
+		pages = append(pages, parentDiffPage(page, n))
+	}
+	return pages
+}
 
-			// Check if path exists in parent
-			_, err = parentTree.EntryByPath(cleanPath)
-			parentTree.Free()
-			parent.Free()
+// writeTreeIdRedirect writes a page at commit/<tree ID>.html, where commit
+// pages used to live, that redirects to link
+// When several commits share a tree, the newest one keeps the redirect
+func writeTreeIdRedirect(commit *git.Commit, link string, global *GlobalRenderData, pool *renderPool) {
+	page := filepath.Join("commit", commit.TreeId().String()+".html")
+	if _, exists := GlobalManifest.Files[page]; exists {
+		return
+	}
 
-			if err != nil {
-				// Path didn't exist in parent, so it was added in this commit
-				date := commit.Author().When
-				msg := commit.Summary()
-				link := "/commit/" + commit.TreeId().String() + ".html"
-				author := commit.Author().Name
-				commit.Free()
-				return date, msg, link, author
-			}
+	pageEntry := ManifestEntry{Object: commit.Id().String()}
+	GlobalManifest.Files[page] = pageEntry
+	if pageUpToDate(page, pageEntry) {
+		return
+	}
 
-			// For directories and files, we need to check if content changed
-			opts, err := git.DefaultDiffOptions()
-			if err != nil {
-				commit.Free()
-				continue
-			}
+	pool.Go(func() error {
+		file, err := os.Create(filepath.Join(Config.DestDir, page))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
 
-			parentCommit := commit.Parent(0)
-			if parentCommit == nil {
-				date := commit.Author().When
-				msg := commit.Summary()
-				link := "/commit/" + commit.TreeId().String() + ".html"
-				author := commit.Author().Name
-				commit.Free()
-				return date, msg, link, author
-			}
+		return t.ExecuteTemplate(file, "redirect.html", RedirectRenderData{
+			GlobalData: global.atPage(page),
+			Link:       link,
+		})
+	})
+}
 
-			currentTree, _ := commit.Tree()
-			parentTree2, _ := parentCommit.Tree()
+// LastCommitInfo describes the most recent commit that modified a path
+type LastCommitInfo struct {
+	Date   time.Time
+	Msg    string
+	Link   string
+	Author string
+}
 
-			if currentTree != nil && parentTree2 != nil {
-				opts.Pathspec = []string{cleanPath}
-				diff, err := repo.DiffTreeToTree(parentTree2, currentTree, &opts)
+// LastCommitIndex maps repository paths, "" being the root, to the most
+// recent commit that modified them
+type LastCommitIndex map[string]LastCommitInfo
 
-				if currentTree != nil {
-					currentTree.Free()
-				}
-				if parentTree2 != nil {
-					parentTree2.Free()
-				}
-				parentCommit.Free()
-
-				if err == nil {
-					numDeltas, _ := diff.NumDeltas()
-					diff.Free()
-
-					if numDeltas > 0 {
-						// This commit modified the path
-						date := commit.Author().When
-						msg := commit.Summary()
-						link := "/commit/" + commit.TreeId().String() + ".html"
-						author := commit.Author().Name
-						commit.Free()
-						return date, msg, link, author
-					}
-				} else {
-					if diff != nil {
-						diff.Free()
-					}
-				}
-			} else {
-				if currentTree != nil {
-					currentTree.Free()
-				}
-				if parentTree2 != nil {
-					parentTree2.Free()
-				}
-				parentCommit.Free()
-			}
+// commitDeltas returns the deltas of the diff of commit against its first
+// parent, with renames and copies found according to fopts when not nil
+func commitDeltas(repo *git.Repository, commit *git.Commit, opts *git.DiffOptions, fopts *git.DiffFindOptions) ([]git.DiffDelta, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+
+	// The initial commit is diffed against the empty tree
+	var parentTree *git.Tree
+	if commit.ParentCount() > 0 {
+		parent := commit.Parent(0)
+		parentTree, err = parent.Tree()
+		parent.Free()
+		if err != nil {
+			return nil, err
 		}
-		commit.Free()
+		defer parentTree.Free()
+	}
+
+	diff, err := repo.DiffTreeToTree(parentTree, tree, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer diff.Free()
+
+	if fopts != nil {
+		err = diff.FindSimilar(fopts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	numDeltas, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
 	}
 
-	return time.Time{}, "", "", ""
+	deltas := make([]git.DiffDelta, 0, numDeltas)
+	for i := 0; i < numDeltas; i++ {
+		delta, err := diff.Delta(i)
+		if err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas, nil
+}
+
+// getLastCommitInfo returns the date, message, link, and author name of the last commit that modified the given path
+func getLastCommitInfo(repo *git.Repository, repoPath string) (time.Time, string, string, string) {
+	head, err := repo.Head()
+	if err != nil {
+		return time.Time{}, "", "", ""
+	}
+	defer head.Free()
+
+	rh, err := refHistoryFor(repo, head.Target())
+	if err != nil {
+		GlobalWarnings.add("", fmt.Errorf("walking history: %w", err))
+		return time.Time{}, "", "", ""
+	}
+
+	// Remove leading /tree from path for the index lookup
+	cleanPath := strings.TrimPrefix(repoPath, "/tree/")
+	if cleanPath == "/tree" {
+		cleanPath = ""
+	}
+
+	info, ok := rh.Index[cleanPath]
+	if !ok {
+		return time.Time{}, "", "", ""
+	}
+	return info.Date, info.Msg, info.Link, info.Author
 }
 
 // getRootTreeFileList returns the file list for the root tree (non-recursive)
@@ -472,23 +732,32 @@ func getRootTreeFileList(repo *git.Repository, tree *git.Tree) []FileListElem {
 	var filelist []FileListElem
 	count := int(tree.EntryCount())
 	
-	// Separate directories and files
+	// Separate directories, submodules and files
 	var dirs []*git.TreeEntry
+	var submodules []*git.TreeEntry
 	var files []*git.TreeEntry
 	
 	for i := 0; i < count; i++ {
 		entry := tree.EntryByIndex(uint64(i))
+		if excludedPath(entry.Name) {
+			continue
+		}
 		if entry.Type == git.ObjectTree {
 			dirs = append(dirs, entry)
 		} else if entry.Type == git.ObjectBlob {
 			files = append(files, entry)
+		} else if entry.Type == git.ObjectCommit {
+			submodules = append(submodules, entry)
 		}
 	}
 	
-	// Sort directories and files alphabetically (case-insensitive)
+	// Sort directories, submodules and files alphabetically (case-insensitive)
 	sort.Slice(dirs, func(i, j int) bool {
 		return strings.ToLower(dirs[i].Name) < strings.ToLower(dirs[j].Name)
 	})
+	sort.Slice(submodules, func(i, j int) bool {
+		return strings.ToLower(submodules[i].Name) < strings.ToLower(submodules[j].Name)
+	})
 	sort.Slice(files, func(i, j int) bool {
 		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
 	})
@@ -515,9 +784,26 @@ func getRootTreeFileList(repo *git.Repository, tree *git.Tree) []FileListElem {
 		}
 
 		lastModified, commitMsg, commitLink, _ := getLastCommitInfo(repo, filepath.Join("/tree", entry.Name))
-		filelist = append(filelist, FileListElem{entry.Name + "/", filepath.Join("/tree", entry.Name), false, mode, size, lastModified, commitMsg, commitLink})
+		filelist = append(filelist, FileListElem{
+			Name:           entry.Name + "/",
+			Link:           filepath.Join("/tree", entry.Name, "index.html"),
+			Mode:           mode,
+			Size:           size,
+			LastModified:   lastModified,
+			LastCommitMsg:  commitMsg,
+			LastCommitLink: commitLink,
+		})
 	}
 	
+	// Process submodules
+	gitmodules := readGitmodules(repo, tree)
+	for _, entry := range submodules {
+		lastModified, commitMsg, commitLink, _ := getLastCommitInfo(repo, filepath.Join("/tree", entry.Name))
+		elem := submoduleFileListElem(entry, entry.Name, gitmodules)
+		elem.LastModified, elem.LastCommitMsg, elem.LastCommitLink = lastModified, commitMsg, commitLink
+		filelist = append(filelist, elem)
+	}
+
 	// Process files
 	for _, entry := range files {
 		filemode := entry.Filemode
@@ -540,7 +826,16 @@ func getRootTreeFileList(repo *git.Repository, tree *git.Tree) []FileListElem {
 		}
 
 		lastModified, commitMsg, commitLink, _ := getLastCommitInfo(repo, filepath.Join("/tree", entry.Name))
-		filelist = append(filelist, FileListElem{entry.Name, filepath.Join("/tree", entry.Name) + ".html", true, mode, size, lastModified, commitMsg, commitLink})
+		filelist = append(filelist, FileListElem{
+			Name:           entry.Name,
+			Link:           filepath.Join("/tree", entry.Name) + ".html",
+			IsFile:         true,
+			Mode:           mode,
+			Size:           size,
+			LastModified:   lastModified,
+			LastCommitMsg:  commitMsg,
+			LastCommitLink: commitLink,
+		})
 	}
 	
 	return filelist
@@ -573,30 +868,71 @@ func getImageFileContents(repo *git.Repository, treePath, filename string) ([]by
 	return contents, nil
 }
 
-func indexTreeRecursive(repo *git.Repository, tree *git.Tree, path string) {
+// treeRender holds what every page of one generated tree shares
+// It is filled in before rendering starts and only read by render jobs
+type treeRender struct {
+	// root is the path of the tree's top-level page, such as "/tree" for
+	// HEAD or "/refs/<ref>/tree" for other refs
+	root       string
+	head       *git.Oid
+	global     GlobalRenderData
+	fullTree   []FlatTreeItem
+	treeHash   string
+	submodules map[string]Submodule
+	index      LastCommitIndex
+	// history is nil for trees without history pages
+	history *PathHistory
+	// blame is set when the tree gets blame pages, which only the trees of
+	// HEAD and refs do: blaming every tree of every commit does not scale
+	blame bool
+	// assets is set when the tree is that of the working directory, which
+	// images are written to the assets directory from
+	assets bool
+	pool   *renderPool
+}
+
+// lastCommitInfo returns the date, message, link, and author name of the
+// last commit that modified the given path below tr.root
+func (tr *treeRender) lastCommitInfo(treePath string) (time.Time, string, string, string) {
+	cleanPath := strings.TrimPrefix(strings.TrimPrefix(treePath, tr.root), "/")
+	info, ok := tr.index[cleanPath]
+	if !ok {
+		return time.Time{}, "", "", ""
+	}
+	return info.Date, info.Msg, info.Link, info.Author
+}
+
+func indexTreeRecursive(repo *git.Repository, tree *git.Tree, path string, tr *treeRender) error {
 	var filelist []FileListElem
 	count := int(tree.EntryCount())
+	dir := strings.TrimPrefix(strings.TrimPrefix(path, tr.root), "/")
 	
-	// Separate directories and files
+	// Separate directories, submodules and files
 	var dirs []*git.TreeEntry
+	var submodules []*git.TreeEntry
 	var files []*git.TreeEntry
 	
 	for i := 0; i < count; i++ {
 		entry := tree.EntryByIndex(uint64(i))
+		if excludedPath(filepath.Join(dir, entry.Name)) {
+			continue
+		}
 		if entry.Type == git.ObjectTree {
 			dirs = append(dirs, entry)
 		} else if entry.Type == git.ObjectBlob {
 			files = append(files, entry)
 		} else if entry.Type == git.ObjectCommit {
-			log.Print("FATAL: submodules not implemented")
-			log.Fatal()
+			submodules = append(submodules, entry)
 		}
 	}
 	
-	// Sort directories and files alphabetically (case-insensitive)
+	// Sort directories, submodules and files alphabetically (case-insensitive)
 	sort.Slice(dirs, func(i, j int) bool {
 		return strings.ToLower(dirs[i].Name) < strings.ToLower(dirs[j].Name)
 	})
+	sort.Slice(submodules, func(i, j int) bool {
+		return strings.ToLower(submodules[i].Name) < strings.ToLower(submodules[j].Name)
+	})
 	sort.Slice(files, func(i, j int) bool {
 		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
 	})
@@ -625,21 +961,41 @@ func indexTreeRecursive(repo *git.Repository, tree *git.Tree, path string) {
 		// possibly very slow?
 		nexttree, err := repo.LookupTree(entry.Id)
 		if err != nil {
-			log.Fatal()
+			return err
 		}
 
 		newpath := filepath.Join(path, entry.Name)
 
 		err = makeDir(filepath.Join(Config.DestDir, newpath))
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		lastModified, commitMsg, commitLink, _ := getLastCommitInfo(repo, filepath.Join(path, entry.Name))
-		filelist = append(filelist, FileListElem{entry.Name + "/", newpath, false, mode, size, lastModified, commitMsg, commitLink})
-		indexTreeRecursive(repo, nexttree, newpath)
+		lastModified, commitMsg, commitLink, _ := tr.lastCommitInfo(filepath.Join(path, entry.Name))
+		filelist = append(filelist, FileListElem{
+			Name:           entry.Name + "/",
+			Link:           newpath + "/index.html",
+			Mode:           mode,
+			Size:           size,
+			LastModified:   lastModified,
+			LastCommitMsg:  commitMsg,
+			LastCommitLink: commitLink,
+		})
+		err = indexTreeRecursive(repo, nexttree, newpath, tr)
+		if err != nil {
+			return err
+		}
 	}
 	
+	// Process submodules
+	for _, entry := range submodules {
+		newpath := filepath.Join(path, entry.Name)
+		lastModified, commitMsg, commitLink, _ := tr.lastCommitInfo(newpath)
+		elem := submoduleFileListElem(entry, strings.TrimPrefix(newpath, tr.root+"/"), tr.submodules)
+		elem.LastModified, elem.LastCommitMsg, elem.LastCommitLink = lastModified, commitMsg, commitLink
+		filelist = append(filelist, elem)
+	}
+
 	// Process files
 	for _, entry := range files {
 		filemode := entry.Filemode
@@ -663,89 +1019,123 @@ func indexTreeRecursive(repo *git.Repository, tree *git.Tree, path string) {
 
 		blob, err = repo.LookupBlob(entry.Id)
 		if err != nil {
-			log.Fatal()
+			return err
 		}
 
 		newpath := filepath.Join(path, entry.Name)
-		file, err := os.Create(filepath.Join(Config.DestDir, newpath+".html"))
+		currentPath := newpath + ".html"
 
-		if err != nil {
-			log.Fatal(err)
+		lastModified, commitMsg, commitLink, commitAuthor := tr.lastCommitInfo(filepath.Join(path, entry.Name))
+		permalink := commitTreeLink(commitLink, strings.TrimPrefix(newpath, tr.root+"/"))
+		blameLink := ""
+		if tr.blame {
+			blameLink = newpath + ".blame.html"
 		}
+		historyLink := tr.historyLink(newpath, true)
 
-		lines := highlightFileContents(entry.Name, blob.Contents())
-
-		lastModified, commitMsg, commitLink, commitAuthor := getLastCommitInfo(repo, filepath.Join(path, entry.Name))
+		page := strings.TrimPrefix(currentPath, "/")
+		pageEntry := ManifestEntry{Object: entry.Id.String(), LastCommit: commitLink, Tree: tr.treeHash}
+		GlobalManifest.Files[page] = pageEntry
 
-		currentPath := newpath + ".html"
+		if !pageUpToDate(page, pageEntry) {
+			name := entry.Name
+			contents := blob.Contents()
+			tr.pool.Go(func() error {
+				file, err := os.Create(filepath.Join(Config.DestDir, currentPath))
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+
+				lines := highlightFileContents(name, contents)
+
+				err = t.ExecuteTemplate(file, "file.html", FileRenderData{
+					GlobalData: tr.global.atPage(page),
+					FileViewData: FileViewRenderData{
+						Name:             name,
+						Lines:            lines,
+						LastCommitMsg:    commitMsg,
+						LastCommitLink:   commitLink,
+						LastCommitDate:   lastModified,
+						LastCommitAuthor: commitAuthor,
+						Permalink:        permalink,
+						BlameLink:        blameLink,
+						HistoryLink:      historyLink,
+						RepoName:         Config.RepoName,
+						CurrentPath:      currentPath,
+						Depth:            pageDepth(page),
+					},
+					FullTree:    tr.fullTree,
+					CurrentPath: currentPath,
+				})
+				if err != nil {
+					GlobalWarnings.add(page, err)
+				}
+				return file.Sync()
+			})
+		}
 
-		err = t.ExecuteTemplate(file, "file.html", FileRenderData{
-			GlobalData: &GlobalDataGlobal,
-			FileViewData: FileViewRenderData{
-				Name:             entry.Name,
-				Lines:            lines,
-				LastCommitMsg:    commitMsg,
-				LastCommitLink:   commitLink,
-				LastCommitDate:   lastModified,
-				LastCommitAuthor: commitAuthor,
-				RepoName:         Config.RepoName,
-				CurrentPath:      currentPath,
-			},
-			FullTree:    GlobalFullTree,
-			CurrentPath: currentPath,
-		})
-		if err != nil {
-			log.Print("execute:", err)
+		if tr.blame {
+			writeBlamePage(repo, tr, entry.Name, newpath, blob.Contents(), pageEntry)
+		}
+		if tr.history != nil {
+			writeHistoryPage(tr, newpath, true)
 		}
-		file.Sync()
-		defer file.Close()
 
 		// If this is an image file, also write it to the assets directory
 		// Read from working directory to handle Git LFS properly
-		if isImageFile(entry.Name) {
-			imagePath := filepath.Join(Config.DestDir, "assets", entry.Name)
-			imageContents, err := getImageFileContents(repo, path, entry.Name)
-			if err != nil {
-				// Fallback to blob contents if reading from working directory fails
-				log.Print("warning: failed to read image from working directory, using blob contents:", err)
-				imageContents = blob.Contents()
-			}
-			err = os.WriteFile(imagePath, imageContents, 0644)
-			if err != nil {
-				log.Print("write image:", err)
+		if tr.assets && isImageFile(entry.Name) {
+			assetPage := filepath.Join("assets", entry.Name)
+			assetEntry := ManifestEntry{Object: entry.Id.String()}
+			GlobalManifest.Files[assetPage] = assetEntry
+
+			if !pageUpToDate(assetPage, assetEntry) {
+				imagePath := filepath.Join(Config.DestDir, assetPage)
+				imageContents, err := getImageFileContents(repo, path, entry.Name)
+				if err != nil {
+					// Fallback to blob contents if reading from working directory fails
+					GlobalWarnings.add(assetPage, fmt.Errorf("reading image from working directory, using blob contents: %w", err))
+					imageContents = blob.Contents()
+				}
+				err = os.WriteFile(imagePath, imageContents, 0644)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
-		filelist = append(filelist, FileListElem{entry.Name, newpath + ".html", true, mode, size, lastModified, commitMsg, commitLink})
-	}
-	treefile, err := os.Create(filepath.Join(Config.DestDir, path, "index.html"))
-	if err != nil {
-		log.Fatal(err)
+		filelist = append(filelist, FileListElem{
+			Name:           entry.Name,
+			Link:           newpath + ".html",
+			IsFile:         true,
+			Mode:           mode,
+			Size:           size,
+			LastModified:   lastModified,
+			LastCommitMsg:  commitMsg,
+			LastCommitLink: commitLink,
+		})
 	}
 
 	// Calculate parent path
 	var parentPath string
 	hasParent := false
-	if path != "/tree" {
+	if path != tr.root {
 		// For paths like "/tree/subdir", parent is "/tree"
 		// For "/tree/a/b", parent is "/tree/a"
 		parentPath = filepath.Dir(path)
-		if parentPath != "/tree" {
-			parentPath = parentPath + "/"
-		}
 		hasParent = true
 	}
-	// For root "/tree", no parent link
+	// For the root, such as "/tree", no parent link
 
 	// Get latest commit info for this folder
 	var latestCommit CommitListElem
 	commitFound := false
-	lastModified, commitMsg, commitLink, commitAuthor := getLastCommitInfo(repo, path)
+	lastModified, commitMsg, commitLink, commitAuthor := tr.lastCommitInfo(path)
 	if commitMsg != "" && commitLink != "" {
-		// Extract treeId from commitLink (format: "/commit/{treeId}.html")
-		treeId := strings.TrimPrefix(commitLink, "/commit/")
-		treeId = strings.TrimSuffix(treeId, ".html")
-		abbrevHash := treeId
+		// Extract commitId from commitLink (format: "/commit/{commitId}.html")
+		commitId := strings.TrimPrefix(commitLink, "/commit/")
+		commitId = strings.TrimSuffix(commitId, ".html")
+		abbrevHash := commitId
 		if len(abbrevHash) > 8 {
 			abbrevHash = abbrevHash[:8]
 		}
@@ -760,21 +1150,41 @@ func indexTreeRecursive(repo *git.Repository, tree *git.Tree, path string) {
 		commitFound = true
 	}
 
-	err = t.ExecuteTemplate(treefile, "tree.html", TreeRenderData{
-		GlobalData:   &GlobalDataGlobal,
-		Files:        filelist,
-		CurrentPath:  path,
-		ParentPath:   parentPath,
-		HasParent:    hasParent,
-		LatestCommit: latestCommit,
-		CommitFound:  commitFound,
-		FullTree:     GlobalFullTree,
-	})
-	if err != nil {
-		log.Print("execute:", err)
+	if tr.history != nil {
+		writeHistoryPage(tr, path, false)
 	}
-	treefile.Sync()
-	defer treefile.Close()
+
+	page := strings.TrimPrefix(filepath.Join(path, "index.html"), "/")
+	pageEntry := ManifestEntry{Object: tree.Id().String(), LastCommit: commitLink, Tree: tr.treeHash}
+	GlobalManifest.Files[page] = pageEntry
+	if pageUpToDate(page, pageEntry) {
+		return nil
+	}
+
+	tr.pool.Go(func() error {
+		treefile, err := os.Create(filepath.Join(Config.DestDir, page))
+		if err != nil {
+			return err
+		}
+		defer treefile.Close()
+
+		err = t.ExecuteTemplate(treefile, "tree.html", TreeRenderData{
+			GlobalData:   tr.global.atPage(page),
+			Files:        filelist,
+			CurrentPath:  path + "/index.html",
+			ParentPath:   parentPath,
+			HasParent:    hasParent,
+			LatestCommit: latestCommit,
+			CommitFound:  commitFound,
+			HistoryLink:  tr.historyLink(path, false),
+			FullTree:     tr.fullTree,
+		})
+		if err != nil {
+			GlobalWarnings.add(page, err)
+		}
+		return treefile.Sync()
+	})
+	return nil
 }
 
 // flattenTree flattens a tree structure with depth information
@@ -794,10 +1204,12 @@ func flattenTree(items []TreeItem, depth int) []FlatTreeItem {
 	return flat
 }
 
-// buildFullTreeRecursive builds the complete repository tree structure
-func buildFullTreeRecursive(repo *git.Repository, tree *git.Tree, path string) []TreeItem {
+// buildFullTreeRecursive builds the complete repository tree structure of the
+// tree at path below root
+func buildFullTreeRecursive(repo *git.Repository, tree *git.Tree, root, path string) []TreeItem {
 	var items []TreeItem
 	count := int(tree.EntryCount())
+	dir := strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
 
 	// Sort entries: directories first, then files
 	var dirs []*git.TreeEntry
@@ -805,6 +1217,9 @@ func buildFullTreeRecursive(repo *git.Repository, tree *git.Tree, path string) [
 
 	for i := 0; i < count; i++ {
 		entry := tree.EntryByIndex(uint64(i))
+		if excludedPath(filepath.Join(dir, entry.Name)) {
+			continue
+		}
 		if entry.Type == git.ObjectTree {
 			dirs = append(dirs, entry)
 		} else if entry.Type == git.ObjectBlob {
@@ -824,14 +1239,14 @@ func buildFullTreeRecursive(repo *git.Repository, tree *git.Tree, path string) [
 	for _, entry := range dirs {
 		nexttree, err := repo.LookupTree(entry.Id)
 		if err != nil {
-			log.Print("warning: failed to lookup tree:", err)
+			GlobalWarnings.add(strings.TrimPrefix(filepath.Join(path, entry.Name), "/"), fmt.Errorf("looking up tree: %w", err))
 			continue
 		}
 
 		newpath := filepath.Join(path, entry.Name)
-		children := buildFullTreeRecursive(repo, nexttree, newpath)
+		children := buildFullTreeRecursive(repo, nexttree, root, newpath)
 
-		link := newpath
+		link := newpath + "/index.html"
 
 		items = append(items, TreeItem{
 			Name:     entry.Name,
@@ -859,68 +1274,81 @@ func buildFullTreeRecursive(repo *git.Repository, tree *git.Tree, path string) [
 	return items
 }
 
-func indexTree(repo *git.Repository, head *git.Oid) {
+// indexTree generates the tree and file pages of the tree of head below root,
+// which is "/tree" for HEAD, reading last-commit info from the index of head
+// With a history, it also generates the history page of every path
+func indexTree(repo *git.Repository, head *git.Oid, root string, index LastCommitIndex, history *PathHistory) error {
 	commit, err := repo.LookupCommit(head)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	tree, err := commit.Tree()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Build full tree structure once and store globally (flattened)
-	treeItems := buildFullTreeRecursive(repo, tree, "/tree")
-	GlobalFullTree = flattenTree(treeItems, 0)
-
-	indexTreeRecursive(repo, tree, "/tree")
-}
-
-// getContributors walks through the commit history and returns a list of unique contributors
-// based on their email addresses
-func getContributors(repo *git.Repository, head *git.Oid) []Contributor {
-	emailToContributor := make(map[string]Contributor)
-
-	walk, err := repo.Walk()
+	err = makeDir(filepath.Join(Config.DestDir, root))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	if err = walk.Push(head); err != nil {
-		log.Fatal(err)
+
+	// Build full tree structure once (flattened); every page shares it
+	treeItems := buildFullTreeRecursive(repo, tree, root, root)
+	tr := &treeRender{
+		root:       root,
+		head:       head,
+		global:     GlobalDataGlobal,
+		fullTree:   flattenTree(treeItems, 0),
+		submodules: readGitmodules(repo, tree),
+		index:      index,
+		history:    history,
+		blame:      Config.Blame && !strings.HasPrefix(root, "/commit/"),
+		// images are read from the working directory, which only HEAD's tree matches
+		assets: root == "/tree",
+		pool:   newRenderPool(Config.Jobs),
 	}
+	tr.treeHash = hashFullTree(tr.fullTree)
 
-	id := git.Oid{}
-	for {
-		if err = walk.Next(&id); err != nil {
-			// at the end of the commit history
-			break
-		}
+	defer tr.pool.Wait()
 
-		commit, err := repo.LookupCommit(&id)
-		if err != nil {
-			log.Fatal(err)
-		}
+	err = indexTreeRecursive(repo, tree, root, tr)
+	if err != nil {
+		return err
+	}
+	return tr.pool.Wait()
+}
 
-		author := commit.Author()
-		email := author.Email
+// commitTreeRoot returns the root of the tree generated for the commit id
+func commitTreeRoot(id string) string {
+	return "/commit/" + id + "/tree"
+}
 
-		// Only add if we haven't seen this email before
-		if _, exists := emailToContributor[email]; !exists {
-			emailToContributor[email] = Contributor{
-				Name:  author.Name,
-				Email: email,
-			}
-		}
-		commit.Free()
+// commitTreeLink returns the link to repoPath, a file path relative to the
+// tree root, in the tree generated for the commit behind commitLink, or an
+// empty string when no trees are generated for commits
+func commitTreeLink(commitLink, repoPath string) string {
+	if !Config.CommitTrees || commitLink == "" {
+		return ""
 	}
+	id := strings.TrimSuffix(strings.TrimPrefix(commitLink, "/commit/"), ".html")
+	return commitTreeRoot(id) + "/" + repoPath + ".html"
+}
 
-	// Convert map to slice
-	contributors := make([]Contributor, 0, len(emailToContributor))
-	for _, contributor := range emailToContributor {
-		contributors = append(contributors, contributor)
+// indexCommitTree generates the tree of commit at /commit/<commit ID>/tree,
+// whose pages keep showing the same content after later pushes
+// The tree of a commit never changes, so when the commit page is up to date,
+// a tree the previous build generated is kept as is
+func indexCommitTree(repo *git.Repository, commit *git.Commit, upToDate bool) error {
+	root := commitTreeRoot(commit.Id().String())
+	if upToDate && GlobalManifest.keepPrefix(GlobalPrevManifest, strings.TrimPrefix(root, "/")+"/") {
+		return nil
 	}
 
-	return contributors
+	index, err := commitLastCommitIndex(repo, commit)
+	if err != nil {
+		return err
+	}
+	return indexTree(repo, commit.Id(), root, index, nil)
 }
 
 // getBranchName returns the name of the current branch that HEAD points to
@@ -950,7 +1378,7 @@ func getBranches(repo *git.Repository) []RefListElem {
 
 	iter, err := repo.NewBranchIterator(git.BranchAll)
 	if err != nil {
-		log.Print("failed to create branch iterator:", err)
+		GlobalWarnings.add("", fmt.Errorf("creating branch iterator: %w", err))
 		return branches
 	}
 	defer iter.Free()
@@ -968,20 +1396,20 @@ func getBranches(repo *git.Repository) []RefListElem {
 		defer ref.Free()
 
 		commitHash := ref.Target().String()
-		logLink := "/log/" + name
 
 		branches = append(branches, RefListElem{
 			Name:       name,
+			RefName:    ref.Name(),
 			Type:       "branch",
 			CommitHash: commitHash[:8],
-			LogLink:    logLink,
+			Target:     commitHash,
 		})
 
 		return nil
 	})
 
 	if err != nil {
-		log.Print("error iterating branches:", err)
+		GlobalWarnings.add("", fmt.Errorf("iterating branches: %w", err))
 	}
 
 	return branches
@@ -998,42 +1426,32 @@ func getTags(repo *git.Repository) []RefListElem {
 			tagName = name[10:]
 		}
 
-		// Try to peel the tag to get the commit it points to
+		// Peel the tag, through any nested tags, to the commit it points to
 		obj, err := repo.Lookup(oid)
 		if err != nil {
 			return nil
 		}
 		defer obj.Free()
-
-		var commitHash string
-		if obj.Type() == git.ObjectTag {
-			tag, err := obj.AsTag()
-			if err != nil {
-				return nil
-			}
-			target := tag.Target()
-			if target != nil {
-				commitHash = target.Id().String()
-				target.Free()
-			}
-		} else if obj.Type() == git.ObjectCommit {
-			commitHash = oid.String()
-		}
-
-		if commitHash != "" {
-			tags = append(tags, RefListElem{
-				Name:       tagName,
-				Type:       "tag",
-				CommitHash: commitHash[:8],
-				LogLink:    "", // Tags don't have log links
-			})
+		commit, err := obj.Peel(git.ObjectCommit)
+		if err != nil {
+			// a tag of a tree or a blob
+			return nil
 		}
+		commitHash := commit.Id().String()
+		commit.Free()
 
+		tags = append(tags, RefListElem{
+			Name:       tagName,
+			RefName:    name,
+			Type:       "tag",
+			CommitHash: commitHash[:8],
+			Target:     commitHash,
+		})
 		return nil
 	})
 
 	if err != nil {
-		log.Print("error iterating tags:", err)
+		GlobalWarnings.add("", fmt.Errorf("iterating tags: %w", err))
 	}
 
 	return tags
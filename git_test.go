@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +19,18 @@ func setGlobalTemplate(tmpl *template.Template) {
 	t = tmpl
 }
 
+// parseTestTemplates parses the templates of Config.InstallDir as the ones
+// pages are rendered with
+func parseTestTemplates(t *testing.T) {
+	t.Helper()
+	templ = template.New("").Funcs(funcmap)
+	parsedTemplate, err := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
+	if err != nil {
+		t.Fatalf("failed to parse templates: %v", err)
+	}
+	setGlobalTemplate(parsedTemplate)
+}
+
 // createTestRepo creates a simple test repository for testing
 func createTestRepo(t *testing.T) (*git.Repository, string) {
 	t.Helper()
@@ -166,17 +181,13 @@ func TestGetCommitLog(t *testing.T) {
 		// Create a commit
 		commitId := createCommitInRepo(t, repo, repoPath, "test.txt", "hello world", "Initial commit")
 
-		// Parse templates before calling getcommitlog
-		templ = template.New("").Funcs(funcmap)
-		var err error
-		parsedTemplate, err := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
-		if err != nil {
-			t.Fatalf("failed to parse templates: %v", err)
-		}
-		setGlobalTemplate(parsedTemplate)
+		parseTestTemplates(t)
 
 		// Get commit log
-		commitList := getCommitLog(repo, commitId)
+		commitList, err := getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
 
 		if len(commitList) != 1 {
 			t.Errorf("expected 1 commit, got %d", len(commitList))
@@ -202,16 +213,13 @@ func TestGetCommitLog(t *testing.T) {
 		_ = createCommitInRepo(t, repo, repoPath, "file2.txt", "content2", "Second commit")
 		headId := createCommitInRepo(t, repo, repoPath, "file3.txt", "content3", "Third commit")
 
-		// Parse templates
-		templ = template.New("").Funcs(funcmap)
-		parsedTemplate, err := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
-		if err != nil {
-			t.Fatalf("failed to parse templates: %v", err)
-		}
-		setGlobalTemplate(parsedTemplate)
+		parseTestTemplates(t)
 
 		// Get commit log
-		commitList := getCommitLog(repo, headId)
+		commitList, err := getCommitLog(repo, headId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
 
 		if len(commitList) != 3 {
 			t.Errorf("expected 3 commits, got %d", len(commitList))
@@ -226,6 +234,50 @@ func TestGetCommitLog(t *testing.T) {
 		}
 	})
 
+	t.Run("names commit pages by commit id", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		origRedirects := Config.TreeIdRedirects
+		Config.TreeIdRedirects = true
+		defer func() { Config.TreeIdRedirects = origRedirects }()
+
+		commitId := createCommitInRepo(t, repo, repoPath, "test.txt", "content", "Initial commit")
+
+		parseTestTemplates(t)
+
+		commitList, err := getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+		if len(commitList) != 1 {
+			t.Fatalf("expected 1 commit, got %d", len(commitList))
+		}
+
+		expectedLink := "/commit/" + commitId.String() + ".html"
+		if commitList[0].Link != expectedLink {
+			t.Errorf("expected link %q, got %q", expectedLink, commitList[0].Link)
+		}
+		if commitList[0].AbbrevHash != commitId.String()[:8] {
+			t.Errorf("expected abbreviated hash %q, got %q", commitId.String()[:8], commitList[0].AbbrevHash)
+		}
+		if _, err := os.Stat(filepath.Join(Config.DestDir, "commit", commitId.String()+".html")); err != nil {
+			t.Errorf("commit page not created: %v", err)
+		}
+
+		commit, err := repo.LookupCommit(commitId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		redirect, err := os.ReadFile(filepath.Join(Config.DestDir, "commit", commit.TreeId().String()+".html"))
+		if err != nil {
+			t.Fatalf("redirect page not created: %v", err)
+		}
+		if !strings.Contains(string(redirect), expectedLink) {
+			t.Errorf("expected redirect to %q, got %q", expectedLink, string(redirect))
+		}
+	})
+
 	t.Run("truncates long commit messages", func(t *testing.T) {
 		repo, repoPath := createTestRepo(t)
 		defer repo.Free()
@@ -238,15 +290,12 @@ func TestGetCommitLog(t *testing.T) {
 		longMsg := "This is a very long commit message that should be truncated"
 		commitId := createCommitInRepo(t, repo, repoPath, "test.txt", "content", longMsg)
 
-		// Parse templates
-		templ = template.New("").Funcs(funcmap)
-		parsedTemplate, err := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
+		parseTestTemplates(t)
+
+		commitList, err := getCommitLog(repo, commitId)
 		if err != nil {
-			t.Fatalf("failed to parse templates: %v", err)
+			t.Fatalf("getCommitLog() failed: %v", err)
 		}
-		setGlobalTemplate(parsedTemplate)
-
-		commitList := getCommitLog(repo, commitId)
 
 		if len(commitList) != 1 {
 			t.Fatalf("expected 1 commit, got %d", len(commitList))
@@ -261,6 +310,299 @@ func TestGetCommitLog(t *testing.T) {
 			t.Errorf("expected 'This is...', got '%s'", commitList[0].Msg)
 		}
 	})
+
+	t.Run("generates the side by side view next to commit pages", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		origSplitDiffs := Config.SplitDiffs
+		Config.SplitDiffs = true
+		defer func() { Config.SplitDiffs = origSplitDiffs }()
+
+		createCommitInRepo(t, repo, repoPath, "test.txt", "one", "First")
+		commitId := createCommitInRepo(t, repo, repoPath, "test.txt", "two", "Second")
+
+		parseTestTemplates(t)
+
+		_, err = getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		page := filepath.Join("commit", commitId.String()+".split.html")
+		if _, err := os.Stat(filepath.Join(Config.DestDir, page)); err != nil {
+			t.Errorf("side by side view not created: %v", err)
+		}
+		if _, ok := GlobalManifest.Files[page]; !ok {
+			t.Errorf("side by side view not recorded in the manifest")
+		}
+	})
+
+	t.Run("writes both sides of changed images as assets", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "logo.png", "\x89PNG\x00one", "Add logo")
+		commitId := createCommitInRepo(t, repo, repoPath, "logo.png", "\x89PNG\x00two", "Change logo")
+
+		parseTestTemplates(t)
+
+		_, err = getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		assets := GlobalManifest.CommitAssets[commitId.String()]
+		if len(assets) != 2 {
+			t.Fatalf("expected the old and the new image, got %v", assets)
+		}
+		contents, err := os.ReadFile(filepath.Join(Config.DestDir, assets[1]))
+		if err != nil {
+			t.Fatalf("expected the new image to be written: %v", err)
+		}
+		if string(contents) != "\x89PNG\x00two" {
+			t.Errorf("unexpected contents of the new image %q", contents)
+		}
+	})
+
+	t.Run("writes the patch and the diff next to commit pages", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "test.txt", "one\n", "First")
+		commitId := createCommitInRepo(t, repo, repoPath, "test.txt", "two\n", "Second")
+
+		parseTestTemplates(t)
+
+		_, err = getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		base := filepath.Join(Config.DestDir, "commit", commitId.String())
+		patch, err := os.ReadFile(base + ".patch")
+		if err != nil {
+			t.Fatalf("patch not created: %v", err)
+		}
+		if !strings.HasPrefix(string(patch), "From "+commitId.String()) || !strings.Contains(string(patch), "Subject: [PATCH] Second\n") {
+			t.Errorf("unexpected patch %q", patch)
+		}
+		diff, err := os.ReadFile(base + ".diff")
+		if err != nil {
+			t.Fatalf("diff not created: %v", err)
+		}
+		if !strings.Contains(string(diff), "-one\n+two\n") {
+			t.Errorf("unexpected diff %q", diff)
+		}
+	})
+
+	t.Run("lists the files of root commits like their patch", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		commitId := createCommitInRepo(t, repo, repoPath, "README.md", "# Test\n", "Initial commit")
+
+		templ = template.New("").Funcs(funcmap)
+		parsedTemplate, err := templ.Parse(`{{define "commit.html"}}{{range .Files}}{{.NewPath}}|{{.Status}}|{{.Additions}};{{end}}{{end}}`)
+		if err != nil {
+			t.Fatalf("failed to parse templates: %v", err)
+		}
+		setGlobalTemplate(parsedTemplate)
+
+		_, err = getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		base := filepath.Join(Config.DestDir, "commit", commitId.String())
+		content, err := os.ReadFile(base + ".html")
+		if err != nil {
+			t.Fatalf("commit page not created: %v", err)
+		}
+		if expected := "README.md|added|1;"; string(content) != expected {
+			t.Errorf("expected the added file on the page, %q, got %q", expected, string(content))
+		}
+		diff, err := os.ReadFile(base + ".diff")
+		if err != nil {
+			t.Fatalf("diff not created: %v", err)
+		}
+		if !strings.Contains(string(diff), "+# Test") {
+			t.Errorf("expected the added file in the diff, got %q", string(diff))
+		}
+	})
+
+	t.Run("collapses large and generated diffs onto pages of their own", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		origLines := Config.DiffMaxLines
+		Config.DiffMaxLines = 5
+		defer func() { Config.DiffMaxLines = origLines }()
+
+		createCommitInRepo(t, repo, repoPath, ".gitattributes", "*.gen.go linguist-generated\n", "Attributes")
+		genId := createCommitInRepo(t, repo, repoPath, "api.gen.go", "package api\n", "Generate")
+		commitId := createCommitInRepo(t, repo, repoPath, "long.txt", strings.Repeat("line\n", 10), "Long")
+
+		// every file as path|reason|link, then the lines of its diff
+		templ = template.New("").Funcs(funcmap)
+		parsedTemplate, err := templ.Parse(`{{define "commit.html"}}{{range .Files}}{{.NewPath}}|{{.Collapsed}}|{{.Link}}` +
+			`{{range .Lines}}{{.}}{{end}};{{end}}{{end}}`)
+		if err != nil {
+			t.Fatalf("failed to parse templates: %v", err)
+		}
+		setGlobalTemplate(parsedTemplate)
+
+		_, err = getCommitLog(repo, commitId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		page := filepath.Join("commit", commitId.String()+".html")
+		content, err := os.ReadFile(filepath.Join(Config.DestDir, page))
+		if err != nil {
+			t.Fatalf("commit page not created: %v", err)
+		}
+		filePage := diffFilePage(page, "long.txt")
+		if expected := "long.txt|" + collapsedLarge + "|/" + filePage + ";"; string(content) != expected {
+			t.Errorf("expected the diff of long.txt to be collapsed into a link, %q, got %q", expected, string(content))
+		}
+		if _, ok := GlobalManifest.Files[filePage]; !ok {
+			t.Errorf("expected %s in the manifest", filePage)
+		}
+
+		single, err := os.ReadFile(filepath.Join(Config.DestDir, filePage))
+		if err != nil {
+			t.Fatalf("file diff page not created: %v", err)
+		}
+		if !strings.HasPrefix(string(single), "long.txt||") || strings.Count(string(single), "line") < 10 {
+			t.Errorf("expected the whole diff of long.txt on its page, got %q", string(single))
+		}
+
+		genCommitPage := filepath.Join("commit", genId.String()+".html")
+		content, err = os.ReadFile(filepath.Join(Config.DestDir, genCommitPage))
+		if err != nil {
+			t.Fatalf("commit page not created: %v", err)
+		}
+		genPage := diffFilePage(genCommitPage, "api.gen.go")
+		if expected := "api.gen.go|" + collapsedGenerated + "|/" + genPage + ";"; string(content) != expected {
+			t.Errorf("expected the diff of api.gen.go to be collapsed as generated, %q, got %q", expected, string(content))
+		}
+		single, err = os.ReadFile(filepath.Join(Config.DestDir, genPage))
+		if err != nil {
+			t.Fatalf("file diff page not created: %v", err)
+		}
+		if !strings.HasPrefix(string(single), "api.gen.go||") || !strings.Contains(string(single), "package") {
+			t.Errorf("expected the whole diff of api.gen.go on its page, got %q", string(single))
+		}
+	})
+
+	t.Run("links commit pages to their neighbours in the log", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		firstId := createCommitInRepo(t, repo, repoPath, "test.txt", "one\n", "First")
+		secondId := createCommitInRepo(t, repo, repoPath, "test.txt", "two\n", "Second")
+		thirdId := createCommitInRepo(t, repo, repoPath, "test.txt", "three\n", "Third")
+
+		parseTestTemplates(t)
+
+		_, err = getCommitLog(repo, thirdId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+
+		page := filepath.Join("commit", secondId.String()+".html")
+		expected := CommitNav{
+			PrevLink: "/commit/" + thirdId.String() + ".html",
+			NextLink: "/commit/" + firstId.String() + ".html",
+		}
+		if got := GlobalManifest.Files[page].Nav; got != hashCommitNav(expected) {
+			t.Errorf("expected the middle commit to link to the newer and the older one")
+		}
+	})
+
+	t.Run("walks all parents of merges", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		origAllParents := Config.AllParents
+		Config.AllParents = true
+		defer func() { Config.AllParents = origAllParents }()
+
+		baseId := createCommitInRepo(t, repo, repoPath, "file1.txt", "content1", "Base")
+		base, err := repo.LookupCommit(baseId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		baseTree, err := base.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+
+		sig := &git.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+		sideId, err := repo.CreateCommit("refs/heads/side", sig, sig, "Side", baseTree, base)
+		if err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+		side, err := repo.LookupCommit(sideId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+
+		mainId := createCommitInRepo(t, repo, repoPath, "file2.txt", "content2", "Main")
+		tip, err := repo.LookupCommit(mainId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		mainTree, err := tip.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		mergeId, err := repo.CreateCommit("HEAD", sig, sig, "Merge", mainTree, tip, side)
+		if err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+
+		parseTestTemplates(t)
+
+		commitList, err := getCommitLog(repo, mergeId)
+		if err != nil {
+			t.Fatalf("getCommitLog() failed: %v", err)
+		}
+		if len(commitList) != 4 {
+			t.Fatalf("expected 4 commits, got %d", len(commitList))
+		}
+		if commitList[0].Msg != "Merge" || commitList[3].Msg != "Base" {
+			t.Errorf("expected the merge first and the base last, got %q and %q", commitList[0].Msg, commitList[3].Msg)
+		}
+
+		if _, err := os.Stat(filepath.Join(Config.DestDir, "commit", sideId.String()+".html")); err != nil {
+			t.Errorf("commit page of the merged commit not created: %v", err)
+		}
+		if commitList[0].Graph.Width != 2 || commitList[3].Graph.Column != 0 {
+			t.Errorf("expected the merge to open a second lane, got %+v and %+v", commitList[0].Graph, commitList[3].Graph)
+		}
+
+		page := filepath.Join("commit", mergeId.String()+".html")
+		if _, err := os.Stat(filepath.Join(Config.DestDir, parentDiffPage(page, 1))); err != nil {
+			t.Errorf("diff against the second parent not created: %v", err)
+		}
+		if _, ok := GlobalManifest.Files[parentDiffPage(page, 1)]; !ok {
+			t.Errorf("expected the diff against the second parent in the manifest")
+		}
+
+		merge, err := repo.LookupCommit(mergeId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		merged, count, err := mergedCommits(repo, merge)
+		if err != nil {
+			t.Fatalf("mergedCommits() failed: %v", err)
+		}
+		if count != 1 || len(merged) != 1 || merged[0].Hash != sideId.String() {
+			t.Errorf("expected the side commit to be the only one merged, got %d: %+v", count, merged)
+		}
+	})
 }
 
 func TestIndexTree(t *testing.T) {
@@ -312,16 +654,13 @@ func TestIndexTree(t *testing.T) {
 		// Create a commit with files
 		commitId := createCommitInRepo(t, repo, repoPath, "README.md", "# Test", "Initial commit")
 
-		// Parse templates
-		templ = template.New("").Funcs(funcmap)
-		parsedTemplate, err := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
-		if err != nil {
-			t.Fatalf("failed to parse templates: %v", err)
-		}
-		setGlobalTemplate(parsedTemplate)
+		parseTestTemplates(t)
 
 		// Run indexTree
-		indexTree(repo, commitId)
+		err = indexTree(repo, commitId, "/tree", nil, nil)
+		if err != nil {
+			t.Fatalf("indexTree() failed: %v", err)
+		}
 
 		// Verify tree directory was created
 		treePath := filepath.Join(Config.DestDir, "tree")
@@ -409,16 +748,13 @@ func TestIndexTree(t *testing.T) {
 			t.Fatalf("failed to create commit: %v", err)
 		}
 
-		// Parse templates
-		templ = template.New("").Funcs(funcmap)
-		parsedTemplate, err2 := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
-		if err2 != nil {
-			t.Fatalf("failed to parse templates: %v", err2)
-		}
-		setGlobalTemplate(parsedTemplate)
+		parseTestTemplates(t)
 
 		// Run indexTree
-		indexTree(repo, commitId)
+		err = indexTree(repo, commitId, "/tree", nil, nil)
+		if err != nil {
+			t.Fatalf("indexTree() failed: %v", err)
+		}
 
 		// Verify nested directory was created
 		srcPath := filepath.Join(Config.DestDir, "tree", "src")
@@ -486,13 +822,7 @@ func TestIndexTreeRecursive(t *testing.T) {
 			t.Fatalf("failed to get tree: %v", err)
 		}
 
-		// Parse templates
-		templ = template.New("").Funcs(funcmap)
-		parsedTemplate, err2 := templ.ParseGlob(filepath.Join(Config.InstallDir, "templates/*.html"))
-		if err2 != nil {
-			t.Fatalf("failed to parse templates: %v", err2)
-		}
-		setGlobalTemplate(parsedTemplate)
+		parseTestTemplates(t)
 
 		// Create the tree path
 		treePath := "/tree"
@@ -502,7 +832,15 @@ func TestIndexTreeRecursive(t *testing.T) {
 		}
 
 		// Run indexTreeRecursive
-		indexTreeRecursive(repo, tree, treePath)
+		tr := &treeRender{root: treePath, global: GlobalDataGlobal, pool: newRenderPool(2)}
+		err = indexTreeRecursive(repo, tree, treePath, tr)
+		if err != nil {
+			t.Fatalf("indexTreeRecursive() failed: %v", err)
+		}
+		err = tr.pool.Wait()
+		if err != nil {
+			t.Fatalf("render pool failed: %v", err)
+		}
 
 		// Verify file was created
 		filePath := filepath.Join(Config.DestDir, treePath, "test.txt.html")
@@ -516,6 +854,73 @@ func TestIndexTreeRecursive(t *testing.T) {
 			t.Error("index.html was not created")
 		}
 	})
+
+	t.Run("lists submodules with their pinned commit", func(t *testing.T) {
+		repo, _ := createTestRepo(t)
+		defer repo.Free()
+
+		gitmodules, err := repo.CreateBlobFromBuffer([]byte("[submodule \"lib\"]\n\tpath = lib\n\turl = https://github.com/hltk/lib.git\n"))
+		if err != nil {
+			t.Fatalf("failed to create blob: %v", err)
+		}
+		pinned, err := git.NewOid("0123456789abcdef0123456789abcdef01234567")
+		if err != nil {
+			t.Fatalf("failed to parse oid: %v", err)
+		}
+
+		builder, err := repo.TreeBuilder()
+		if err != nil {
+			t.Fatalf("failed to create tree builder: %v", err)
+		}
+		defer builder.Free()
+		if err = builder.Insert(".gitmodules", gitmodules, git.FilemodeBlob); err != nil {
+			t.Fatalf("failed to insert .gitmodules: %v", err)
+		}
+		if err = builder.Insert("lib", pinned, git.FilemodeCommit); err != nil {
+			t.Fatalf("failed to insert submodule: %v", err)
+		}
+		treeId, err := builder.Write()
+		if err != nil {
+			t.Fatalf("failed to write tree: %v", err)
+		}
+		tree, err := repo.LookupTree(treeId)
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+
+		templ = template.New("").Funcs(funcmap)
+		parsedTemplate, err := templ.Parse(`{{define "tree.html"}}{{range .Files}}{{if .IsSubmodule}}{{.Name}} {{.SubmoduleCommit}} {{.SubmoduleLink}}{{end}}{{end}}{{end}}` +
+			`{{define "file.html"}}file{{end}}`)
+		if err != nil {
+			t.Fatalf("failed to parse templates: %v", err)
+		}
+		setGlobalTemplate(parsedTemplate)
+
+		treePath := "/tree"
+		err = os.MkdirAll(filepath.Join(Config.DestDir, treePath), 0755)
+		if err != nil {
+			t.Fatalf("failed to create tree path: %v", err)
+		}
+
+		tr := &treeRender{root: treePath, global: GlobalDataGlobal, submodules: readGitmodules(repo, tree), pool: newRenderPool(1)}
+		err = indexTreeRecursive(repo, tree, treePath, tr)
+		if err != nil {
+			t.Fatalf("indexTreeRecursive() failed: %v", err)
+		}
+		err = tr.pool.Wait()
+		if err != nil {
+			t.Fatalf("render pool failed: %v", err)
+		}
+
+		index, err := os.ReadFile(filepath.Join(Config.DestDir, treePath, "index.html"))
+		if err != nil {
+			t.Fatalf("failed to read index.html: %v", err)
+		}
+		expected := "lib 0123456789abcdef0123456789abcdef01234567 https://github.com/hltk/lib"
+		if string(index) != expected {
+			t.Errorf("expected %q, got %q", expected, string(index))
+		}
+	})
 }
 
 func TestGetImageFileContents(t *testing.T) {
@@ -679,3 +1084,275 @@ func TestGetImageFileContents(t *testing.T) {
 		}
 	})
 }
+
+func TestWalkRefHistory(t *testing.T) {
+	t.Run("maps every path to the last commit that modified it", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		err := os.MkdirAll(filepath.Join(repoPath, "src"), 0755)
+		if err != nil {
+			t.Fatalf("failed to create subdir: %v", err)
+		}
+
+		createCommitInRepo(t, repo, repoPath, "README.md", "# Test", "Add readme")
+		createCommitInRepo(t, repo, repoPath, "src/main.go", "package main", "Add main")
+		headId := createCommitInRepo(t, repo, repoPath, "README.md", "# Test\n\nMore.", "Update readme")
+
+		rh, err := walkRefHistory(repo, headId)
+		if err != nil {
+			t.Fatalf("walkRefHistory() failed: %v", err)
+		}
+
+		expected := map[string]string{
+			"":            "Update readme",
+			"README.md":   "Update readme",
+			"src":         "Add main",
+			"src/main.go": "Add main",
+		}
+		for path, msg := range expected {
+			info, ok := rh.Index[path]
+			if !ok {
+				t.Errorf("path %q missing from index", path)
+				continue
+			}
+			if info.Msg != msg {
+				t.Errorf("path %q: expected last commit %q, got %q", path, msg, info.Msg)
+			}
+		}
+	})
+
+	t.Run("collects the history of every path and the contributors", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "a.txt", "a", "Add a")
+		createCommitInRepo(t, repo, repoPath, "b.txt", "b", "Add b")
+		headId := createCommitInRepo(t, repo, repoPath, "a.txt", "aa", "Change a")
+
+		rh, err := walkRefHistory(repo, headId)
+		if err != nil {
+			t.Fatalf("walkRefHistory() failed: %v", err)
+		}
+
+		var msgs []string
+		for _, commit := range rh.History.commitsOf("a.txt") {
+			msgs = append(msgs, commit.Msg)
+		}
+		if expected := []string{"Change a", "Add a"}; !reflect.DeepEqual(msgs, expected) {
+			t.Errorf("expected the history of a.txt to be %v, got %v", expected, msgs)
+		}
+		if expected := []Contributor{{Name: "Test User", Email: "test@example.com"}}; !reflect.DeepEqual(rh.Contributors, expected) {
+			t.Errorf("expected contributors %v, got %v", expected, rh.Contributors)
+		}
+	})
+
+	t.Run("indexes the trees of older commits from the walk of the head", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "a.txt", "a", "Add a")
+		middleId := createCommitInRepo(t, repo, repoPath, "b.txt", "b", "Add b")
+		headId := createCommitInRepo(t, repo, repoPath, "a.txt", "aa", "Change a")
+
+		if _, err := refHistoryFor(repo, headId); err != nil {
+			t.Fatalf("refHistoryFor() failed: %v", err)
+		}
+		middle, err := repo.LookupCommit(middleId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer middle.Free()
+		index, err := commitLastCommitIndex(repo, middle)
+		if err != nil {
+			t.Fatalf("commitLastCommitIndex() failed: %v", err)
+		}
+
+		expected := map[string]string{"": "Add b", "a.txt": "Add a", "b.txt": "Add b"}
+		if len(index) != len(expected) {
+			t.Errorf("expected %d paths, got %v", len(expected), index)
+		}
+		for path, msg := range expected {
+			if index[path].Msg != msg {
+				t.Errorf("path %q: expected last commit %q, got %q", path, msg, index[path].Msg)
+			}
+		}
+		if len(refHistoryCache.histories) != 1 {
+			t.Errorf("expected the walk of the head to be reused, got %d walks", len(refHistoryCache.histories))
+		}
+	})
+
+	t.Run("getLastCommitInfo reads from the index", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "a.txt", "a", "Add a")
+		createCommitInRepo(t, repo, repoPath, "b.txt", "b", "Add b")
+
+		_, msg, link, author := getLastCommitInfo(repo, "/tree/a.txt")
+		if msg != "Add a" {
+			t.Errorf("expected message 'Add a', got %q", msg)
+		}
+		if link == "" {
+			t.Error("expected a commit link")
+		}
+		if author != "Test User" {
+			t.Errorf("expected author 'Test User', got %q", author)
+		}
+
+		_, msg, _, _ = getLastCommitInfo(repo, "/tree")
+		if msg != "Add b" {
+			t.Errorf("expected root message 'Add b', got %q", msg)
+		}
+	})
+}
+
+func TestCommitTreeLink(t *testing.T) {
+	origCommitTrees := Config.CommitTrees
+	defer func() { Config.CommitTrees = origCommitTrees }()
+
+	Config.CommitTrees = false
+	if got := commitTreeLink("/commit/abc.html", "dir/file.go"); got != "" {
+		t.Errorf("expected no link without commit trees, got %q", got)
+	}
+
+	Config.CommitTrees = true
+	if got := commitTreeLink("/commit/abc.html", "dir/file.go"); got != "/commit/abc/tree/dir/file.go.html" {
+		t.Errorf("unexpected link: %q", got)
+	}
+	if got := commitTreeLink("", "dir/file.go"); got != "" {
+		t.Errorf("expected no link without a last commit, got %q", got)
+	}
+}
+
+func TestParentDiffPage(t *testing.T) {
+	page := filepath.Join("commit", "abc.html")
+	if got := parentDiffPage(page, 0); got != page {
+		t.Errorf("expected the first parent to use the commit page, got %q", got)
+	}
+	if got := parentDiffPage(page, 1); got != filepath.Join("commit", "abc.parent2.html") {
+		t.Errorf("unexpected page of the second parent %q", got)
+	}
+
+	diffs := []ParentDiff{{Number: 1}, {Number: 2}}
+	marked := currentParentDiff(diffs, 1)
+	if marked[0].Current || !marked[1].Current || diffs[1].Current {
+		t.Errorf("expected only a copy of the second parent diff to be marked, got %+v", marked)
+	}
+	if currentParentDiff(nil, 0) != nil {
+		t.Errorf("expected no parent diffs for commits that are not merges")
+	}
+}
+
+func TestDiffCommit(t *testing.T) {
+	t.Run("finds files renamed with edits", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		var lines []string
+		for i := 0; i < 20; i++ {
+			lines = append(lines, fmt.Sprintf("line %d", i))
+		}
+		createCommitInRepo(t, repo, repoPath, "old.txt", strings.Join(lines, "\n")+"\n", "Add old")
+
+		// rename old.txt to new.txt and change one of its lines
+		lines[10] = "changed"
+		if err := os.Remove(filepath.Join(repoPath, "old.txt")); err != nil {
+			t.Fatalf("failed to remove file: %v", err)
+		}
+		idx, err := repo.Index()
+		if err != nil {
+			t.Fatalf("failed to get index: %v", err)
+		}
+		if err := idx.RemoveByPath("old.txt"); err != nil {
+			t.Fatalf("failed to remove file from index: %v", err)
+		}
+		if err := idx.Write(); err != nil {
+			t.Fatalf("failed to write index: %v", err)
+		}
+		commitId := createCommitInRepo(t, repo, repoPath, "new.txt", strings.Join(lines, "\n")+"\n", "Rename")
+
+		commit, err := repo.LookupCommit(commitId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer commit.Free()
+		tree, err := commit.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		defer tree.Free()
+
+		diff, err := diffCommit(repo, commit, 0, tree)
+		if err != nil {
+			t.Fatalf("diffCommit() failed: %v", err)
+		}
+		defer diff.Free()
+		files, err := commitFileDiffs(repo, diff, commitId.String())
+		if err != nil {
+			t.Fatalf("commitFileDiffs() failed: %v", err)
+		}
+
+		if len(files) != 1 {
+			t.Fatalf("expected a single renamed file, got %+v", files)
+		}
+		file := files[0]
+		if file.Status != "renamed" || file.OldPath != "old.txt" || file.NewPath != "new.txt" {
+			t.Errorf("expected old.txt renamed to new.txt, got %+v", file)
+		}
+		if file.Similarity <= 50 || file.Similarity >= 100 {
+			t.Errorf("expected the similarity of an edited file, got %d%%", file.Similarity)
+		}
+	})
+}
+
+func TestNewFileDiff(t *testing.T) {
+	tests := []struct {
+		delta    git.DiffDelta
+		expected fileDiff
+	}{
+		{
+			delta:    git.DiffDelta{Status: git.DeltaAdded, OldFile: git.DiffFile{Path: "a.go"}, NewFile: git.DiffFile{Path: "a.go"}},
+			expected: fileDiff{OldPath: "a.go", NewPath: "a.go", Status: "added"},
+		},
+		{
+			delta:    git.DiffDelta{Status: git.DeltaModified, OldFile: git.DiffFile{Path: "a.go"}, NewFile: git.DiffFile{Path: "a.go"}},
+			expected: fileDiff{OldPath: "a.go", NewPath: "a.go", Status: "modified"},
+		},
+		{
+			delta:    git.DiffDelta{Status: git.DeltaRenamed, Similarity: 87, OldFile: git.DiffFile{Path: "a.go"}, NewFile: git.DiffFile{Path: "b.go"}},
+			expected: fileDiff{OldPath: "a.go", NewPath: "b.go", Status: "renamed", Similarity: 87},
+		},
+		{
+			delta:    git.DiffDelta{Status: git.DeltaCopied, Similarity: 100, OldFile: git.DiffFile{Path: "a.go"}, NewFile: git.DiffFile{Path: "c.go"}},
+			expected: fileDiff{OldPath: "a.go", NewPath: "c.go", Status: "copied", Similarity: 100},
+		},
+		{
+			delta:    git.DiffDelta{Status: git.DeltaDeleted, OldFile: git.DiffFile{Path: "a.go"}, NewFile: git.DiffFile{Path: "a.go"}},
+			expected: fileDiff{OldPath: "a.go", NewPath: "a.go", Status: "deleted"},
+		},
+	}
+
+	for _, tc := range tests {
+		if got := newFileDiff(tc.delta); got != tc.expected {
+			t.Errorf("expected %+v, got %+v", tc.expected, got)
+		}
+	}
+}
+
+func TestCommitHasPage(t *testing.T) {
+	origManifest, origAllParents := GlobalManifest, Config.AllParents
+	defer func() { GlobalManifest, Config.AllParents = origManifest, origAllParents }()
+
+	GlobalManifest = newManifest()
+	GlobalManifest.Commits["aaaaaaaa"] = "commit/aaaaaaaa.html"
+
+	Config.AllParents = false
+	if !commitHasPage("aaaaaaaa") || commitHasPage("bbbbbbbb") {
+		t.Errorf("expected only the walked commit to have a page")
+	}
+	Config.AllParents = true
+	if !commitHasPage("bbbbbbbb") {
+		t.Errorf("expected every commit to have a page when walking all parents")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// Dimensions of a row of the commit graph, in pixels
+const (
+	graphLaneWidth = 14
+	graphRowHeight = 36
+	graphNodeSize  = 4
+	graphColors    = 6
+)
+
+type graphLineKind int
+
+const (
+	// from a lane at the top of the row to the commit
+	graphLineIn graphLineKind = iota
+	// from the top of the row to the bottom, past the commit
+	graphLineThrough
+	// from the commit to a lane at the bottom of the row
+	graphLineOut
+)
+
+// layoutGraph assigns every commit of a log in topological order, newest
+// first, to a lane and records the lines that connect it to the rows above
+// and below
+// Each lane waits for the next commit of a line of history; a commit takes
+// the lane of its first child and hands it on to its first parent, while
+// further parents open new lanes
+func layoutGraph(commits []CommitListElem) {
+	var lanes []string
+
+	freeLane := func(except int) int {
+		for i, hash := range lanes {
+			if hash == "" && i != except {
+				return i
+			}
+		}
+		lanes = append(lanes, "")
+		return len(lanes) - 1
+	}
+	laneOf := func(hash string) int {
+		for i, waiting := range lanes {
+			if waiting == hash {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for n := range commits {
+		commit := &commits[n]
+		row := GraphRow{Column: laneOf(commit.Hash)}
+		if row.Column < 0 {
+			// a head of the log, or a commit whose children are not listed
+			row.Column = freeLane(-1)
+		}
+
+		for i, hash := range lanes {
+			switch {
+			case hash == commit.Hash:
+				row.Lines = append(row.Lines, GraphLine{Kind: graphLineIn, From: i, To: row.Column})
+				lanes[i] = ""
+			case hash != "":
+				row.Lines = append(row.Lines, GraphLine{Kind: graphLineThrough, From: i, To: i})
+			}
+		}
+
+		for i, parent := range commit.Parents {
+			lane := laneOf(parent)
+			if lane < 0 {
+				if i == 0 {
+					lane = row.Column
+				} else {
+					lane = freeLane(row.Column)
+				}
+				lanes[lane] = parent
+			}
+			row.Lines = append(row.Lines, GraphLine{Kind: graphLineOut, From: row.Column, To: lane})
+		}
+
+		for len(lanes) > 0 && lanes[len(lanes)-1] == "" {
+			lanes = lanes[:len(lanes)-1]
+		}
+
+		row.Width = row.Column + 1
+		for _, line := range row.Lines {
+			row.Width = max(row.Width, line.From+1, line.To+1)
+		}
+		commit.Graph = row
+	}
+}
+
+// laneX returns the horizontal center of lane
+func laneX(lane int) int {
+	return lane*graphLaneWidth + graphLaneWidth/2
+}
+
+// SVG draws the row as an inline SVG image, or returns nothing for a row
+// that was never laid out
+func (r GraphRow) SVG() template.HTML {
+	if r.Width == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="graph" width="%d" height="%d" viewBox="0 0 %d %d" aria-hidden="true">`,
+		r.Width*graphLaneWidth, graphRowHeight, r.Width*graphLaneWidth, graphRowHeight)
+
+	middle := graphRowHeight / 2
+	for _, line := range r.Lines {
+		var x1, y1, x2, y2, color int
+		switch line.Kind {
+		case graphLineIn:
+			x1, y1, x2, y2, color = laneX(line.From), 0, laneX(line.To), middle, line.From
+		case graphLineThrough:
+			x1, y1, x2, y2, color = laneX(line.From), 0, laneX(line.To), graphRowHeight, line.To
+		case graphLineOut:
+			x1, y1, x2, y2, color = laneX(line.From), middle, laneX(line.To), graphRowHeight, line.To
+		}
+		fmt.Fprintf(&b, `<line class="lane%d" x1="%d" y1="%d" x2="%d" y2="%d"/>`, color%graphColors, x1, y1, x2, y2)
+	}
+
+	fmt.Fprintf(&b, `<circle class="lane%d" cx="%d" cy="%d" r="%d"/>`, r.Column%graphColors, laneX(r.Column), middle, graphNodeSize)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
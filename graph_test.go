@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayoutGraph(t *testing.T) {
+	commit := func(hash string, parents ...string) CommitListElem {
+		return CommitListElem{Hash: hash, Parents: parents}
+	}
+
+	t.Run("linear history stays in one lane", func(t *testing.T) {
+		commits := []CommitListElem{commit("c", "b"), commit("b", "a"), commit("a")}
+		layoutGraph(commits)
+
+		for _, c := range commits {
+			if c.Graph.Column != 0 || c.Graph.Width != 1 {
+				t.Errorf("%s: expected a single lane, got %+v", c.Hash, c.Graph)
+			}
+		}
+		if len(commits[2].Graph.Lines) != 1 || commits[2].Graph.Lines[0].Kind != graphLineIn {
+			t.Errorf("expected the root commit to only be joined from above, got %+v", commits[2].Graph.Lines)
+		}
+	})
+
+	t.Run("merge opens and closes a lane", func(t *testing.T) {
+		// m merges s into b; both branch off a
+		commits := []CommitListElem{
+			commit("m", "b", "s"),
+			commit("s", "a"),
+			commit("b", "a"),
+			commit("a"),
+		}
+		layoutGraph(commits)
+
+		expected := []GraphRow{
+			{Column: 0, Width: 2, Lines: []GraphLine{
+				{Kind: graphLineOut, From: 0, To: 0},
+				{Kind: graphLineOut, From: 0, To: 1},
+			}},
+			{Column: 1, Width: 2, Lines: []GraphLine{
+				{Kind: graphLineThrough, From: 0, To: 0},
+				{Kind: graphLineIn, From: 1, To: 1},
+				{Kind: graphLineOut, From: 1, To: 1},
+			}},
+			{Column: 0, Width: 2, Lines: []GraphLine{
+				{Kind: graphLineIn, From: 0, To: 0},
+				{Kind: graphLineThrough, From: 1, To: 1},
+				{Kind: graphLineOut, From: 0, To: 1},
+			}},
+			{Column: 1, Width: 2, Lines: []GraphLine{
+				{Kind: graphLineIn, From: 1, To: 1},
+			}},
+		}
+		for i, c := range commits {
+			if !reflect.DeepEqual(c.Graph, expected[i]) {
+				t.Errorf("%s: expected %+v, got %+v", c.Hash, expected[i], c.Graph)
+			}
+		}
+	})
+
+	t.Run("unrelated heads get lanes of their own", func(t *testing.T) {
+		commits := []CommitListElem{commit("x", "y"), commit("p"), commit("y")}
+		layoutGraph(commits)
+
+		columns := []int{commits[0].Graph.Column, commits[1].Graph.Column, commits[2].Graph.Column}
+		if !reflect.DeepEqual(columns, []int{0, 1, 0}) {
+			t.Errorf("expected columns [0 1 0], got %v", columns)
+		}
+	})
+}
+
+func TestGraphRowSVG(t *testing.T) {
+	if svg := (GraphRow{}).SVG(); svg != "" {
+		t.Errorf("expected no SVG for an empty row, got %q", svg)
+	}
+
+	row := GraphRow{Column: 1, Width: 2, Lines: []GraphLine{
+		{Kind: graphLineThrough, From: 0, To: 0},
+		{Kind: graphLineIn, From: 1, To: 1},
+	}}
+	svg := string(row.SVG())
+
+	for _, want := range []string{
+		`<svg class="graph" width="28" height="36"`,
+		`<line class="lane0" x1="7" y1="0" x2="7" y2="36"/>`,
+		`<line class="lane1" x1="21" y1="0" x2="21" y2="18"/>`,
+		`<circle class="lane1" cx="21" cy="18" r="4"/>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected %q in %q", want, svg)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// pathChange is a file that a commit changed, by its path before and after
+// the commit
+type pathChange struct {
+	Old     string
+	New     string
+	Renamed bool
+}
+
+// PathHistory lists the commits that modified every path of a tree, newest
+// first
+// Files are followed across renames. Directories list the commits that
+// changed anything below them, under the name the directory had at the time
+type PathHistory struct {
+	Commits []CommitListElem
+	// Paths maps paths at head, "" being the root, to indexes into Commits
+	Paths map[string][]int
+	// names maps the paths that files had in older commits to their path
+	// at head, or to "" for paths that held a different file
+	names map[string]string
+}
+
+func newPathHistory() *PathHistory {
+	return &PathHistory{
+		Paths: make(map[string][]int),
+		names: make(map[string]string),
+	}
+}
+
+// add records the changes of the next older commit
+func (h *PathHistory) add(commit CommitListElem, changes []pathChange) {
+	i := len(h.Commits)
+	h.Commits = append(h.Commits, commit)
+
+	marked := make(map[string]bool)
+	mark := func(p string) {
+		if !marked[p] {
+			marked[p] = true
+			h.Paths[p] = append(h.Paths[p], i)
+		}
+	}
+
+	mark("")
+	renames := make(map[string]string)
+	for _, change := range changes {
+		current, ok := h.names[change.New]
+		if !ok {
+			current = change.New
+		}
+		if current != "" {
+			mark(current)
+		}
+
+		if change.Renamed {
+			// older commits know the file by its old path, and its new
+			// path, if anything, by a different file
+			renames[change.Old] = current
+			if _, ok := renames[change.New]; !ok {
+				renames[change.New] = ""
+			}
+		}
+
+		for _, p := range []string{change.Old, change.New} {
+			for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+				mark(dir)
+			}
+		}
+	}
+
+	// applied once the whole commit is recorded, so that a file renamed
+	// onto the old path of another is still recorded under its own name
+	for old, current := range renames {
+		h.names[old] = current
+	}
+}
+
+// commitsOf returns the commits that modified the path at head, newest first
+func (h *PathHistory) commitsOf(p string) []CommitListElem {
+	indexes := h.Paths[p]
+	commits := make([]CommitListElem, len(indexes))
+	for i, index := range indexes {
+		commits[i] = h.Commits[index]
+	}
+	return commits
+}
+
+// refHistory is what the one first-parent walk of the history of a head
+// collects for the pages of its tree: the last commit of every path, the
+// history of every path, and the contributors
+type refHistory struct {
+	Index        LastCommitIndex // of the tree of the head
+	History      *PathHistory
+	Contributors []Contributor
+
+	// commits are the commits of the walk, newest first, and positions
+	// their indexes by commit ID
+	commits   []LastCommitInfo
+	positions map[git.Oid]int
+	// changes maps every path that a commit changed, and the directories
+	// above it, to the indexes into commits of the commits changing it
+	changes map[string][]int
+	emails  map[string]bool
+}
+
+// walkRefHistory walks the whole first-parent history from head once,
+// diffing every commit against its parent with rename detection
+func walkRefHistory(repo *git.Repository, head *git.Oid) (*refHistory, error) {
+	walk, err := repo.Walk()
+	if err != nil {
+		return nil, err
+	}
+	defer walk.Free()
+
+	if err = walk.Push(head); err != nil {
+		return nil, err
+	}
+	walk.SimplifyFirstParent()
+
+	opts, err := git.DefaultDiffOptions()
+	if err != nil {
+		return nil, err
+	}
+	fopts, err := git.DefaultDiffFindOptions()
+	if err != nil {
+		return nil, err
+	}
+	fopts.Flags |= git.DiffFindRenames
+
+	rh := &refHistory{
+		History:   newPathHistory(),
+		positions: make(map[git.Oid]int),
+		changes:   make(map[string][]int),
+		emails:    make(map[string]bool),
+	}
+	id := git.Oid{}
+	for walk.Next(&id) == nil {
+		commit, err := repo.LookupCommit(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		deltas, err := commitDeltas(repo, commit, &opts, &fopts)
+		if err != nil {
+			commit.Free()
+			return nil, err
+		}
+		rh.add(commit, deltas)
+		commit.Free()
+	}
+
+	headCommit, err := repo.LookupCommit(head)
+	if err != nil {
+		return nil, err
+	}
+	defer headCommit.Free()
+	rh.Index, err = rh.lastCommitIndex(headCommit, 0)
+	if err != nil {
+		return nil, err
+	}
+	return rh, nil
+}
+
+// add records the next older commit, whose diff against its first parent is
+// deltas
+func (rh *refHistory) add(commit *git.Commit, deltas []git.DiffDelta) {
+	i := len(rh.commits)
+	author := commit.Author()
+	rh.commits = append(rh.commits, LastCommitInfo{
+		Date:   author.When,
+		Msg:    commit.Summary(),
+		Link:   "/commit/" + commit.Id().String() + ".html",
+		Author: author.Name,
+	})
+	rh.positions[*commit.Id()] = i
+	if !rh.emails[author.Email] {
+		rh.emails[author.Email] = true
+		rh.Contributors = append(rh.Contributors, Contributor{Name: author.Name, Email: author.Email})
+	}
+
+	changes := make([]pathChange, 0, len(deltas))
+	for _, delta := range deltas {
+		changes = append(changes, pathChange{
+			Old:     delta.OldFile.Path,
+			New:     delta.NewFile.Path,
+			Renamed: delta.Status == git.DeltaRenamed,
+		})
+		for _, p := range []string{delta.OldFile.Path, delta.NewFile.Path} {
+			// Once a path is marked, so are all of its parent directories
+			for ; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+				if n := len(rh.changes[p]); n > 0 && rh.changes[p][n-1] == i {
+					break
+				}
+				rh.changes[p] = append(rh.changes[p], i)
+			}
+		}
+	}
+	rh.History.add(newCommitListElem(commit), changes)
+}
+
+// lastCommitIndex returns the index of the tree of commit, the commit at i
+// in the walk: every path maps to the first commit from i on changing it
+func (rh *refHistory) lastCommitIndex(commit *git.Commit, i int) (LastCommitIndex, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+
+	// The root directory was last modified by the commit itself
+	index := LastCommitIndex{"": rh.commits[i]}
+	err = tree.Walk(func(root string, entry *git.TreeEntry) error {
+		p := root + entry.Name
+		commits := rh.changes[p]
+		if k := sort.SearchInts(commits, i); k < len(commits) {
+			index[p] = rh.commits[commits[k]]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// refHistoryCache holds the walk of every head of the repository, so that
+// every page of a build reads from a single walk per ref
+var refHistoryCache struct {
+	repo      *git.Repository
+	histories map[git.Oid]*refHistory
+}
+
+// refHistoryFor returns the walk of the history of head, walking the history
+// only if no walk of the repository was for head yet
+func refHistoryFor(repo *git.Repository, head *git.Oid) (*refHistory, error) {
+	if refHistoryCache.repo != repo {
+		refHistoryCache.repo = repo
+		refHistoryCache.histories = make(map[git.Oid]*refHistory)
+	}
+	if rh, ok := refHistoryCache.histories[*head]; ok {
+		return rh, nil
+	}
+
+	rh, err := walkRefHistory(repo, head)
+	if err != nil {
+		return nil, err
+	}
+	refHistoryCache.histories[*head] = rh
+	return rh, nil
+}
+
+// commitLastCommitIndex returns the index of the tree of commit from a walk
+// whose first-parent history holds the commit, such as that of the ref whose
+// log lists it, walking the history from commit only if none does
+func commitLastCommitIndex(repo *git.Repository, commit *git.Commit) (LastCommitIndex, error) {
+	if refHistoryCache.repo == repo {
+		for _, rh := range refHistoryCache.histories {
+			if i, ok := rh.positions[*commit.Id()]; ok {
+				return rh.lastCommitIndex(commit, i)
+			}
+		}
+	}
+
+	rh, err := refHistoryFor(repo, commit.Id())
+	if err != nil {
+		return nil, err
+	}
+	return rh.Index, nil
+}
+
+// historyLink returns the link to the history page of the path below tr.root,
+// or an empty string when the tree has no history pages
+// The history of tr.root itself is at index.html below the history root
+func (tr *treeRender) historyLink(treePath string, isFile bool) string {
+	if tr.history == nil {
+		return ""
+	}
+	historyRoot := strings.TrimSuffix(tr.root, "/tree") + "/history"
+	link := historyRoot + strings.TrimPrefix(treePath, tr.root)
+	if isFile {
+		return link + ".html"
+	}
+	return link + "/index.html"
+}
+
+// historyPageLink returns the link to page n, counting from 1, of the history
+// whose first page is at first; like the pages of the log, the others are in
+// a page directory, next to the first page of a file
+func historyPageLink(first string, n int) string {
+	if n == 1 {
+		return first
+	}
+	return logPageLink(strings.TrimSuffix(strings.TrimSuffix(first, "/index.html"), ".html"), n)
+}
+
+// writeHistoryPage submits the rendering of the history pages of the path
+// below tr.root, in the format of the log, split into pages of
+// Config.LogPageSize commits
+func writeHistoryPage(tr *treeRender, treePath string, isFile bool) {
+	repoPath := strings.TrimPrefix(strings.TrimPrefix(treePath, tr.root), "/")
+	commits := tr.history.commitsOf(repoPath)
+	first := tr.historyLink(treePath, isFile)
+	pageLink := func(n int) string { return historyPageLink(first, n) }
+
+	// the history of a path is fixed once its newest commit is
+	entry := ManifestEntry{Object: repoPath}
+	if len(commits) > 0 {
+		entry.LastCommit = commits[0].Link
+	}
+
+	displayPath := repoPath
+	if displayPath == "" {
+		displayPath = "/"
+	}
+
+	pages := paginate(commits, Config.LogPageSize)
+	for i, pageCommits := range pages {
+		page := strings.TrimPrefix(pageLink(i+1), "/")
+		GlobalManifest.Files[page] = entry
+		if pageUpToDate(page, entry) {
+			continue
+		}
+
+		data := LogRenderData{
+			GlobalData: tr.global.atPage(page),
+			Commits:    pageCommits,
+			Path:       displayPath,
+			Pagination: newPagination(i+1, len(pages), pageLink),
+		}
+		tr.pool.Go(func() error {
+			err := os.MkdirAll(filepath.Dir(filepath.Join(Config.DestDir, page)), 0755)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Create(filepath.Join(Config.DestDir, page))
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			err = t.ExecuteTemplate(file, "log.html", data)
+			if err != nil {
+				GlobalWarnings.add(page, err)
+			}
+			return file.Sync()
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathHistory(t *testing.T) {
+	commit := func(hash string) CommitListElem {
+		return CommitListElem{Link: "/commit/" + hash + ".html", AbbrevHash: hash}
+	}
+	hashes := func(commits []CommitListElem) []string {
+		var result []string
+		for _, c := range commits {
+			result = append(result, c.AbbrevHash)
+		}
+		return result
+	}
+
+	// history from newest to oldest:
+	// 4: edit src/new.go
+	// 3: rename src/old.go to src/new.go
+	// 2: edit src/old.go and README
+	// 1: add src/new.go, a different file, and delete it again later (not shown)
+	// 0: add src/old.go and README
+	h := newPathHistory()
+	h.add(commit("4"), []pathChange{{Old: "src/new.go", New: "src/new.go"}})
+	h.add(commit("3"), []pathChange{{Old: "src/old.go", New: "src/new.go", Renamed: true}})
+	h.add(commit("2"), []pathChange{{Old: "src/old.go", New: "src/old.go"}, {Old: "README", New: "README"}})
+	h.add(commit("1"), []pathChange{{Old: "src/new.go", New: "src/new.go"}})
+	h.add(commit("0"), []pathChange{{Old: "src/old.go", New: "src/old.go"}, {Old: "README", New: "README"}})
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"src/new.go", []string{"4", "3", "2", "0"}},
+		{"README", []string{"2", "0"}},
+		{"src", []string{"4", "3", "2", "1", "0"}},
+		{"", []string{"4", "3", "2", "1", "0"}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		if got := hashes(h.commitsOf(tt.path)); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("history of %q: expected %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestHistoryLink(t *testing.T) {
+	tr := &treeRender{root: "/tree"}
+	if got := tr.historyLink("/tree/a.txt", true); got != "" {
+		t.Errorf("expected no link without a history, got %q", got)
+	}
+
+	tr.history = newPathHistory()
+	tests := []struct {
+		root     string
+		treePath string
+		isFile   bool
+		expected string
+	}{
+		{"/tree", "/tree", false, "/history/index.html"},
+		{"/tree", "/tree/src", false, "/history/src/index.html"},
+		{"/tree", "/tree/src/a.go", true, "/history/src/a.go.html"},
+		{"/refs/v1.0/tree", "/refs/v1.0/tree/a.go", true, "/refs/v1.0/history/a.go.html"},
+	}
+	for _, tt := range tests {
+		tr.root = tt.root
+		if got := tr.historyLink(tt.treePath, tt.isFile); got != tt.expected {
+			t.Errorf("historyLink(%q) = %q, expected %q", tt.treePath, got, tt.expected)
+		}
+	}
+}
+
+func TestHistoryPageLink(t *testing.T) {
+	tests := []struct {
+		first    string
+		n        int
+		expected string
+	}{
+		{"/history/index.html", 1, "/history/index.html"},
+		{"/history/index.html", 2, "/history/page/2.html"},
+		{"/history/src/index.html", 3, "/history/src/page/3.html"},
+		{"/history/src/a.go.html", 1, "/history/src/a.go.html"},
+		{"/history/src/a.go.html", 2, "/history/src/a.go/page/2.html"},
+	}
+	for _, tt := range tests {
+		if got := historyPageLink(tt.first, tt.n); got != tt.expected {
+			t.Errorf("historyPageLink(%q, %d) = %q, expected %q", tt.first, tt.n, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// basePath returns the path the site is served under, taken from
+// Config.BaseUrl, which prefixes the links of every page
+// It is empty at the domain root
+func basePath() string {
+	u, err := url.Parse(Config.BaseUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// pageBase returns the prefix of the links of a page depth directories below
+// the root of the site, the base template function
+// With relative links it leads from the page up to the root, so that the
+// site works under any path and straight from the disk
+func pageBase(depth int) string {
+	if !Config.RelativeLinks {
+		return basePath()
+	}
+	if depth == 0 {
+		return "."
+	}
+	return strings.TrimSuffix(strings.Repeat("../", depth), "/")
+}
+
+// pageDepth returns the number of directories between page, a path relative
+// to the directory of the repository, and the root of the site
+func pageDepth(page string) int {
+	return strings.Count(filepath.ToSlash(page), "/") + 1
+}
+
+// atPage returns a copy of g for rendering page, a path relative to the
+// directory of the repository
+func (g GlobalRenderData) atPage(page string) *GlobalRenderData {
+	g.Depth = pageDepth(page)
+	return &g
+}
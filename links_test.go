@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	origBaseUrl := Config.BaseUrl
+	defer func() { Config.BaseUrl = origBaseUrl }()
+
+	tests := []struct {
+		baseUrl  string
+		expected string
+	}{
+		{"", ""},
+		{"https://git.example.com", ""},
+		{"https://git.example.com/", ""},
+		{"https://example.com/code/", "/code"},
+		{"/code", "/code"},
+	}
+
+	for _, tc := range tests {
+		Config.BaseUrl = tc.baseUrl
+		if got := basePath(); got != tc.expected {
+			t.Errorf("basePath() with %q = %q, expected %q", tc.baseUrl, got, tc.expected)
+		}
+	}
+}
+
+func TestPageBase(t *testing.T) {
+	origBaseUrl, origRelativeLinks := Config.BaseUrl, Config.RelativeLinks
+	defer func() { Config.BaseUrl, Config.RelativeLinks = origBaseUrl, origRelativeLinks }()
+
+	tests := []struct {
+		baseUrl  string
+		relative bool
+		depth    int
+		expected string
+	}{
+		{"", false, 2, ""},
+		{"https://example.com/code/", false, 0, "/code"},
+		{"https://example.com/code/", false, 3, "/code"},
+		{"https://example.com/code", true, 0, "."},
+		{"https://example.com/code", true, 1, ".."},
+		{"", true, 3, "../../.."},
+	}
+
+	for _, tc := range tests {
+		Config.BaseUrl, Config.RelativeLinks = tc.baseUrl, tc.relative
+		if got := pageBase(tc.depth); got != tc.expected {
+			t.Errorf("pageBase(%d) with %q, relative %v = %q, expected %q", tc.depth, tc.baseUrl, tc.relative, got, tc.expected)
+		}
+	}
+}
+
+func TestPageDepth(t *testing.T) {
+	tests := []struct {
+		page     string
+		expected int
+	}{
+		{"index.html", 1},
+		{"commit/abc.html", 2},
+		{"tree/src/main.go.html", 3},
+		{"log/feature/x/page/2.html", 5},
+	}
+
+	for _, tc := range tests {
+		if got := pageDepth(tc.page); got != tc.expected {
+			t.Errorf("pageDepth(%q) = %d, expected %d", tc.page, got, tc.expected)
+		}
+	}
+}
+
+func TestRedirectPageLinks(t *testing.T) {
+	orig := Config
+	defer func() { Config = orig }()
+	Config.RepoName = "repo"
+
+	tmpl, err := loadTemplates(t.TempDir())
+	if err != nil {
+		t.Fatalf("loadTemplates() failed: %v", err)
+	}
+	global := GlobalRenderData{Config: &Config}
+	render := func() string {
+		var buf bytes.Buffer
+		data := RedirectRenderData{GlobalData: global.atPage("commit/abc.html"), Link: "/commit/def.html"}
+		if err := tmpl.ExecuteTemplate(&buf, "redirect.html", data); err != nil {
+			t.Fatalf("failed to execute redirect.html: %v", err)
+		}
+		return buf.String()
+	}
+
+	Config.BaseUrl = "https://example.com/code/"
+	page := render()
+	for _, link := range []string{`url=/code/repo/commit/def.html"`, `href="/code/repo/commit/def.html"`} {
+		if !strings.Contains(page, link) {
+			t.Errorf("under a base path, expected %s in %q", link, page)
+		}
+	}
+
+	Config.RelativeLinks = true
+	page = render()
+	for _, link := range []string{`url=../../repo/commit/def.html"`, `href="../../repo/commit/def.html"`} {
+		if !strings.Contains(page, link) {
+			t.Errorf("relative to the page, expected %s in %q", link, page)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// logPageLink returns the link to page n, counting from 1, of the log at
+// logRoot; the first page is the log's index
+func logPageLink(logRoot string, n int) string {
+	if n == 1 {
+		return logRoot + "/index.html"
+	}
+	return fmt.Sprintf("%s/page/%d.html", logRoot, n)
+}
+
+// newPagination returns the navigation of page n of pageCount pages, the
+// links to which pageLink returns
+func newPagination(n, pageCount int, pageLink func(n int) string) Pagination {
+	p := Pagination{Page: n, PageCount: pageCount}
+	if n > 1 {
+		p.FirstLink = pageLink(1)
+		p.PrevLink = pageLink(n - 1)
+	}
+	if n < pageCount {
+		p.NextLink = pageLink(n + 1)
+		p.LastLink = pageLink(pageCount)
+	}
+	return p
+}
+
+// paginate splits commits into pages of size commits, where zero or less
+// means a single page; there is always at least one page
+func paginate(commits []CommitListElem, size int) [][]CommitListElem {
+	if size <= 0 || len(commits) <= size {
+		return [][]CommitListElem{commits}
+	}
+
+	var pages [][]CommitListElem
+	for start := 0; start < len(commits); start += size {
+		end := min(start+size, len(commits))
+		pages = append(pages, commits[start:end])
+	}
+	return pages
+}
+
+// writeLogPage executes the log template into page, relative to the
+// destination directory
+func writeLogPage(page string, data LogRenderData) error {
+	err := makeDir(filepath.Dir(filepath.Join(Config.DestDir, page)))
+	if err != nil {
+		return err
+	}
+
+	logfile, err := os.Create(filepath.Join(Config.DestDir, page))
+	if err != nil {
+		return err
+	}
+	defer logfile.Close()
+
+	data.GlobalData = data.GlobalData.atPage(page)
+	err = t.ExecuteTemplate(logfile, "log.html", data)
+	if err != nil {
+		return err
+	}
+	return logfile.Sync()
+}
+
+// writeLog writes the log of the ref with the given name, pointing to
+// target, to log/<name>/, split into pages of Config.LogPageSize commits:
+// log/<name>/index.html and log/<name>/page/<n>.html
+func writeLog(name, target string, commitlist []CommitListElem) error {
+	logRoot := "/log/" + name
+	archiveLink := ""
+	if Config.LogArchives {
+		archiveLink = logRoot + "/archive/index.html"
+	}
+
+	pageLink := func(n int) string { return logPageLink(logRoot, n) }
+	pages := paginate(commitlist, Config.LogPageSize)
+	for i, commits := range pages {
+		page := strings.TrimPrefix(pageLink(i+1), "/")
+		GlobalManifest.Files[page] = ManifestEntry{Object: target}
+
+		err := writeLogPage(page, LogRenderData{
+			GlobalData:  &GlobalDataGlobal,
+			Commits:     commits,
+			Pagination:  newPagination(i+1, len(pages), pageLink),
+			ArchiveLink: archiveLink,
+			Graph:       Config.AllParents,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if Config.LogArchives {
+		return writeLogArchives(logRoot, target, commitlist)
+	}
+	return nil
+}
+
+// groupByMonth groups commits by the year and month of their date, in the
+// time zone of each commit, newest month first
+// Within a month the commits keep their order in the log
+func groupByMonth(logRoot string, commits []CommitListElem) ([]ArchiveYear, map[string][]CommitListElem) {
+	byMonth := make(map[string][]CommitListElem)
+	for _, commit := range commits {
+		key := commit.Date.Format("2006/01")
+		byMonth[key] = append(byMonth[key], commit)
+	}
+
+	keys := make([]string, 0, len(byMonth))
+	for key := range byMonth {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	var years []ArchiveYear
+	for _, key := range keys {
+		month := byMonth[key]
+		year := month[0].Date.Year()
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, ArchiveYear{Year: year})
+		}
+		y := &years[len(years)-1]
+		y.Count += len(month)
+		y.Months = append(y.Months, ArchiveMonth{
+			Name:  month[0].Date.Month().String(),
+			Link:  logRoot + "/archive/" + key + ".html",
+			Count: len(month),
+		})
+	}
+	return years, byMonth
+}
+
+// writeLogArchives writes an archive index of the log at logRoot, listing
+// the number of commits of every month, and a page with the commits of
+// each month
+func writeLogArchives(logRoot, target string, commitlist []CommitListElem) error {
+	years, byMonth := groupByMonth(logRoot, commitlist)
+
+	for key, commits := range byMonth {
+		page := strings.TrimPrefix(logRoot, "/") + "/archive/" + key + ".html"
+		GlobalManifest.Files[page] = ManifestEntry{Object: target}
+
+		err := writeLogPage(page, LogRenderData{
+			GlobalData:  &GlobalDataGlobal,
+			Commits:     commits,
+			Title:       commits[0].Date.Format("January 2006"),
+			ArchiveLink: logRoot + "/archive/index.html",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	page := strings.TrimPrefix(logRoot, "/") + "/archive/index.html"
+	GlobalManifest.Files[page] = ManifestEntry{Object: target}
+
+	err := makeDir(filepath.Dir(filepath.Join(Config.DestDir, page)))
+	if err != nil {
+		return err
+	}
+
+	archivefile, err := os.Create(filepath.Join(Config.DestDir, page))
+	if err != nil {
+		return err
+	}
+	defer archivefile.Close()
+
+	err = t.ExecuteTemplate(archivefile, "archive.html", ArchiveRenderData{
+		GlobalData: GlobalDataGlobal.atPage(page),
+		LogLink:    logRoot,
+		Years:      years,
+	})
+	if err != nil {
+		return err
+	}
+	return archivefile.Sync()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogPageLink(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{1, "/log/main/index.html"},
+		{2, "/log/main/page/2.html"},
+		{10, "/log/main/page/10.html"},
+	}
+
+	for _, tc := range tests {
+		if got := logPageLink("/log/main", tc.n); got != tc.expected {
+			t.Errorf("logPageLink(%d): expected %q, got %q", tc.n, tc.expected, got)
+		}
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int
+		pageCount int
+		expected  Pagination
+	}{
+		{
+			name:      "single page",
+			n:         1,
+			pageCount: 1,
+			expected:  Pagination{Page: 1, PageCount: 1},
+		},
+		{
+			name:      "first page",
+			n:         1,
+			pageCount: 3,
+			expected: Pagination{Page: 1, PageCount: 3,
+				NextLink: "/log/main/page/2.html", LastLink: "/log/main/page/3.html"},
+		},
+		{
+			name:      "middle page",
+			n:         2,
+			pageCount: 3,
+			expected: Pagination{Page: 2, PageCount: 3,
+				FirstLink: "/log/main/index.html", PrevLink: "/log/main/index.html",
+				NextLink: "/log/main/page/3.html", LastLink: "/log/main/page/3.html"},
+		},
+		{
+			name:      "last page",
+			n:         3,
+			pageCount: 3,
+			expected: Pagination{Page: 3, PageCount: 3,
+				FirstLink: "/log/main/index.html", PrevLink: "/log/main/page/2.html"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newPagination(tc.n, tc.pageCount, func(n int) string { return logPageLink("/log/main", n) })
+			if got != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	commits := make([]CommitListElem, 5)
+	for i := range commits {
+		commits[i].AbbrevHash = string(rune('a' + i))
+	}
+	sizes := func(pages [][]CommitListElem) []int {
+		var result []int
+		for _, page := range pages {
+			result = append(result, len(page))
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		commits  []CommitListElem
+		size     int
+		expected []int
+	}{
+		{"even split", commits[:4], 2, []int{2, 2}},
+		{"short last page", commits, 2, []int{2, 2, 1}},
+		{"fits one page", commits, 5, []int{5}},
+		{"unlimited", commits, 0, []int{5}},
+		{"empty log", nil, 2, []int{0}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pages := paginate(tc.commits, tc.size)
+			if got := sizes(pages); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected page sizes %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	pages := paginate(commits, 2)
+	if pages[1][0].AbbrevHash != "c" || pages[2][0].AbbrevHash != "e" {
+		t.Errorf("pages are out of order: %v", pages)
+	}
+}
+
+func TestGroupByMonth(t *testing.T) {
+	commit := func(hash string, date string) CommitListElem {
+		d, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", date, err)
+		}
+		return CommitListElem{AbbrevHash: hash, Date: d}
+	}
+
+	commits := []CommitListElem{
+		commit("e", "2024-02-03T10:00:00Z"),
+		commit("d", "2024-01-31T23:00:00-05:00"),
+		commit("c", "2024-01-02T10:00:00Z"),
+		commit("b", "2023-12-24T10:00:00Z"),
+		commit("a", "2023-11-01T10:00:00Z"),
+	}
+
+	years, byMonth := groupByMonth("/log/main", commits)
+
+	expected := []ArchiveYear{
+		{Year: 2024, Count: 3, Months: []ArchiveMonth{
+			{Name: "February", Link: "/log/main/archive/2024/02.html", Count: 1},
+			{Name: "January", Link: "/log/main/archive/2024/01.html", Count: 2},
+		}},
+		{Year: 2023, Count: 2, Months: []ArchiveMonth{
+			{Name: "December", Link: "/log/main/archive/2023/12.html", Count: 1},
+			{Name: "November", Link: "/log/main/archive/2023/11.html", Count: 1},
+		}},
+	}
+	if !reflect.DeepEqual(years, expected) {
+		t.Errorf("expected %+v, got %+v", expected, years)
+	}
+
+	// commits are grouped in their own time zone
+	january := byMonth["2024/01"]
+	if len(january) != 2 || january[0].AbbrevHash != "d" || january[1].AbbrevHash != "c" {
+		t.Errorf("expected January to hold d and c in order, got %v", january)
+	}
+
+	years, _ = groupByMonth("/log/main", nil)
+	if len(years) != 0 {
+		t.Errorf("expected no years for an empty log, got %v", years)
+	}
+}
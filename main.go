@@ -7,14 +7,21 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	git "github.com/libgit2/git2go/v34"
 )
 
 // run is the core logic of gitgo, extracted for testability.
-// It generates static HTML pages for a git repository.
-func run(repoPath, destDir, installDir string, force bool) error {
+// It generates static HTML pages for a git repository, and returns the
+// problems that did not stop the build as warnings.
+func run(repoPath, destDir, installDir string, force bool) ([]Warning, error) {
+	GlobalWarnings = &warningList{}
+	// Forget what the previous repository of the site set
+	GlobalDataGlobal.LogoFound = false
+	GlobalDataGlobal.CommitCount, GlobalDataGlobal.BranchCount, GlobalDataGlobal.TagCount = 0, 0, 0
+
 	imageloc := filepath.Join(installDir, "logo.png")
 
 	_, err := os.Stat(imageloc)
@@ -23,28 +30,35 @@ func run(repoPath, destDir, installDir string, force bool) error {
 		GlobalDataGlobal.LogoFound = true
 		err := os.Symlink(imageloc, filepath.Join(destDir, "logo.png"))
 		if err != nil && !os.IsExist(err) {
-			return err
+			return nil, err
 		}
 	} else if !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 
 	repo, err := git.OpenRepositoryExtended(repoPath, git.RepositoryOpenNoSearch, "")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	obj, _, err := repo.RevparseExt("HEAD")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	head := obj.Id()
 
+	// Walk the history once up front; every page reads last-commit info,
+	// path histories and contributors from it
+	headHistory, err := refHistoryFor(repo, head)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the repo name using the helper function
 	repoName, err := getRepoName(repoPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	Config.RepoName = repoName
 
@@ -54,7 +68,7 @@ func run(repoPath, destDir, installDir string, force bool) error {
 	// Update the log link to be branch-specific
 	for i, link := range GlobalDataGlobal.Links {
 		if link.Pretty == "log" {
-			GlobalDataGlobal.Links[i].Link = "/log/" + branchName
+			GlobalDataGlobal.Links[i].Link = "/log/" + branchName + "/index.html"
 			break
 		}
 	}
@@ -63,53 +77,71 @@ func run(repoPath, destDir, installDir string, force bool) error {
 	destDir = filepath.Join(destDir, repoName)
 	Config.DestDir = destDir
 
+	// An incremental build updates the output of a previous build in place,
+	// so the destination directory only has to be empty without a manifest
+	GlobalManifest = newManifest()
+	GlobalPrevManifest = newManifest()
+	manifestFound := false
+	if Config.Incremental && !force {
+		GlobalPrevManifest, manifestFound, err = loadManifest(destDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// validate that destination directory doesn't exist or is empty
-	err = validateDestDir(destDir, force)
-	if err != nil {
-		return err
+	if !manifestFound {
+		err = validateDestDir(destDir, force)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	err = makeDir(destDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Generate syntax highlighting CSS
 	chromaCSS, err := generateChromaCSS()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = os.WriteFile(filepath.Join(destDir, "chroma.css"), []byte(chromaCSS), 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Copy styles.css
-	stylesCSS, err := os.ReadFile(filepath.Join(installDir, "templates/styles.css"))
+	tmplDir := templatesDir(installDir)
+	stylesCSS, err := readTemplateFile(tmplDir, "styles.css")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = os.WriteFile(filepath.Join(destDir, "styles.css"), stylesCSS, 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Copy main.js
-	mainJS, err := os.ReadFile(filepath.Join(installDir, "templates/js/main.js"))
+	mainJS, err := readTemplateFile(tmplDir, "js/main.js")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = os.WriteFile(filepath.Join(destDir, "main.js"), mainJS, 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	templ = template.New("").Funcs(funcmap)
-
-	t, err = templ.ParseGlob(filepath.Join(installDir, "templates/*.html"))
+	t, err = loadTemplates(tmplDir)
+	if err != nil {
+		return nil, err
+	}
 
+	settings := append([]string{branchName, strconv.FormatBool(GlobalDataGlobal.LogoFound)}, outputSettings(&Config)...)
+	GlobalManifest.TemplateHash, err = hashTemplates(tmplDir, settings...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var (
@@ -133,7 +165,7 @@ func run(repoPath, destDir, installDir string, force bool) error {
 			blob, err := fileobj.AsBlob()
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			filename := strings.TrimPrefix(file, "HEAD:")
@@ -158,6 +190,7 @@ func run(repoPath, destDir, installDir string, force bool) error {
 			readmefile.LastCommitDate = lastModified
 			readmefile.LastCommitAuthor = commitAuthor
 			readmefile.RepoName = Config.RepoName
+			readmefile.Depth = pageDepth("index.html")
 
 			readmefound = true
 			break
@@ -170,7 +203,7 @@ func run(repoPath, destDir, installDir string, force bool) error {
 			blob, err := fileobj.AsBlob()
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			filename := strings.TrimPrefix(file, "HEAD:")
@@ -186,6 +219,7 @@ func run(repoPath, destDir, installDir string, force bool) error {
 			licensefile.LastCommitDate = lastModified
 			licensefile.LastCommitAuthor = commitAuthor
 			licensefile.RepoName = Config.RepoName
+			licensefile.Depth = pageDepth("index.html")
 
 			licensefound = true
 			break
@@ -195,42 +229,33 @@ func run(repoPath, destDir, installDir string, force bool) error {
 	// Create directories first
 	err = makeDir(filepath.Join(destDir, "commit"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = makeDir(filepath.Join(destDir, "tree"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = makeDir(filepath.Join(destDir, "log"))
 	if err != nil {
-		return err
-	}
-	// Create branch-specific log directory
-	err = makeDir(filepath.Join(destDir, "log", branchName))
-	if err != nil {
-		return err
+		return nil, err
 	}
 	// Create assets directory for images
 	err = makeDir(filepath.Join(destDir, "assets"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Get commit list for commit count and latest commit
-	commitlist := getCommitLog(repo, head)
-	GlobalDataGlobal.CommitCount = len(commitlist)
-
 	// Get latest commit
 	headRef, headErr := repo.Head()
 	if headErr == nil {
 		commit, commitErr := repo.LookupCommit(headRef.Target())
 		headRef.Free()
 		if commitErr == nil {
-			latestCommit.Link = "/commit/" + commit.TreeId().String() + ".html"
+			latestCommit.Link = "/commit/" + commit.Id().String() + ".html"
 			latestCommit.Msg = commit.Summary()
 			latestCommit.Name = commit.Author().Name
 			latestCommit.Date = commit.Author().When
-			latestCommit.AbbrevHash = commit.TreeId().String()[:8]
+			latestCommit.AbbrevHash = commit.Id().String()[:8]
 			commitfound = true
 			commit.Free()
 		}
@@ -248,23 +273,38 @@ func run(repoPath, destDir, installDir string, force bool) error {
 		}
 	}
 
-	// Get contributors
-	contributors := getContributors(repo, head)
+	contributors := headHistory.Contributors
 
 	// Get branches and tags - must be done before generating index page
 	branches := getBranches(repo)
 	tags := getTags(repo)
 
+	// Link the refs to their logs and trees
+	refPages := selectRefPages(repo, branches, tags, branchName)
+
 	// Update global counts
 	GlobalDataGlobal.BranchCount = len(branches)
 	GlobalDataGlobal.TagCount = len(tags)
 
+	// Commit pages show the refs containing them and their nearest tag
+	GlobalRefIndex, err = buildRefIndex(repo, head, branches, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get commit list for commit count and latest commit
+	commitlist, err := getCommitLog(repo, head)
+	if err != nil {
+		return nil, err
+	}
+	GlobalDataGlobal.CommitCount = len(commitlist)
+
 	indexfile, err := os.Create(filepath.Join(destDir, "index.html"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = t.ExecuteTemplate(indexfile, "index.html", IndexRenderData{
-		GlobalData:       &GlobalDataGlobal,
+		GlobalData:       GlobalDataGlobal.atPage("index.html"),
 		ReadmeFile:       readmefile,
 		ReadmeFound:      readmefound,
 		ReadmeIsMarkdown: readmeIsMarkdown,
@@ -281,35 +321,33 @@ func run(repoPath, destDir, installDir string, force bool) error {
 		Tags:             tags,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	indexfile.Sync()
 	defer indexfile.Close()
 
-	logfile, err := os.Create(filepath.Join(destDir, "log", branchName, "index.html"))
+	err = writeLog(branchName, head.String(), commitlist)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = t.ExecuteTemplate(logfile, "log.html", LogRenderData{GlobalData: &GlobalDataGlobal, Commits: commitlist})
+	err = writeCommitFeed(repo, branchName, commitlist)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	logfile.Sync()
-	defer logfile.Close()
 
 	// Generate refs page (kept for backwards compatibility)
 
 	refsfile, err := os.Create(filepath.Join(destDir, "refs.html"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = t.ExecuteTemplate(refsfile, "refs.html", RefsRenderData{
-		GlobalData: &GlobalDataGlobal,
+		GlobalData: GlobalDataGlobal.atPage("refs.html"),
 		Branches:   branches,
 		Tags:       tags,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	refsfile.Sync()
 	defer refsfile.Close()
@@ -317,15 +355,15 @@ func run(repoPath, destDir, installDir string, force bool) error {
 	// Generate branches page
 	branchesfile, err := os.Create(filepath.Join(destDir, "branches.html"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = t.ExecuteTemplate(branchesfile, "branches.html", RefsRenderData{
-		GlobalData: &GlobalDataGlobal,
+		GlobalData: GlobalDataGlobal.atPage("branches.html"),
 		Branches:   branches,
 		Tags:       tags,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	branchesfile.Sync()
 	defer branchesfile.Close()
@@ -333,33 +371,84 @@ func run(repoPath, destDir, installDir string, force bool) error {
 	// Generate tags page
 	tagsfile, err := os.Create(filepath.Join(destDir, "tags.html"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = t.ExecuteTemplate(tagsfile, "tags.html", RefsRenderData{
-		GlobalData: &GlobalDataGlobal,
+		GlobalData: GlobalDataGlobal.atPage("tags.html"),
 		Branches:   branches,
 		Tags:       tags,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	tagsfile.Sync()
 	defer tagsfile.Close()
 
-	indexTree(repo, head)
+	err = indexTree(repo, head, "/tree", headHistory.Index, headHistory.History)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the logs and trees of the other branches and tags
+	err = generateRefPages(repo, refPages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the tag feed once the logs of every ref recorded the pages of their
+	// commits, so that its entries only link commits with a page
+	err = writeTagFeed(repo, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the output of commits and paths that no longer exist
+	err = GlobalManifest.pruneStale(GlobalPrevManifest, destDir)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	err = GlobalManifest.save(destDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return GlobalWarnings.list(), nil
 }
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	flag.StringVar(&Config.DestDir, "destdir", "build", "target directory")
-	flag.StringVar(&Config.InstallDir, "installdir", ".", "install directory containing templates")
+	flag.StringVar(&Config.InstallDir, "installdir", ".", "install directory containing logo.png, gitgo.json and templates replacing the built-in ones")
+	flag.StringVar(&Config.TemplatesDir, "templates", "", "directory of templates and assets replacing the built-in ones of the same name (default <installdir>/templates)")
 	flag.BoolVar(&Config.Force, "force", false, "force overwrite by clearing destination directory if not empty")
+	flag.BoolVar(&Config.Incremental, "incremental", false, "update a previous build in place, re-rendering only pages whose inputs changed")
+	flag.BoolVar(&Config.TreeIdRedirects, "tree-id-redirects", false, "write redirects from the old tree ID commit page paths to the commit ID paths")
+	flag.StringVar(&Config.SubmoduleBaseUrl, "submodule-base-url", "", "link submodules to their commit pages on the gitgo sites under this URL instead of to their remote")
+	flag.BoolVar(&Config.CommitTrees, "commit-trees", false, "generate the tree of every commit at /commit/<commit>/tree, and link file pages to the tree of their last commit")
+	flag.IntVar(&Config.LogPageSize, "log-page-size", 100, "number of commits per log page (0 for a single page)")
+	flag.BoolVar(&Config.LogArchives, "log-archives", false, "generate an archive of the log with a page per month")
+	flag.BoolVar(&Config.AllParents, "all-parents", false, "walk all parents of merges instead of only the first, and draw the commit graph in the log")
+	flag.BoolVar(&Config.SplitDiffs, "split-diffs", false, "also generate a side by side view of the diff of every commit")
+	flag.IntVar(&Config.DiffMaxLines, "diff-max-lines", 2000, "collapse file diffs longer than this many lines into a link to a page of their own (0 for no limit)")
+	flag.IntVar(&Config.DiffMaxBytes, "diff-max-bytes", 1<<20, "collapse the file diffs of a commit past this many bytes in total, and leave out larger ones (0 for no limit)")
+	flag.IntVar(&Config.DiffMaxFiles, "diff-max-files", 300, "show the diffs of at most this many files on a commit page (0 for no limit)")
+	flag.BoolVar(&Config.Blame, "blame", false, "generate a blame page next to every file page")
+	flag.StringVar(&Config.BaseUrl, "base-url", "", "URL the site is served at, e.g. https://example.com/git, whose path prefixes every link and which the links of the feeds start with")
+	flag.BoolVar(&Config.RelativeLinks, "relative-links", false, "make the links of every page relative to the page, so that the site works under any path and from the disk")
+	flag.IntVar(&Config.FeedEntries, "feed-entries", 20, "number of commits and tags in the Atom feeds (0 for all)")
+	flag.StringVar(&Config.HighlightStyle, "highlight-style", "github", "chroma style of the syntax highlighting")
+	flag.Func("excludes", "comma-separated patterns, in the format of .gitattributes, of the paths to leave out of the trees", func(value string) error {
+		Config.Excludes = strings.Split(value, ",")
+		return nil
+	})
+	flag.StringVar(&Config.RefGlob, "ref-glob", "", "generate logs and trees only for the refs whose full name matches this glob, e.g. 'refs/heads/*', instead of for every branch and tag")
+	flag.BoolVar(&Config.Strict, "strict", false, "exit with an error if the build produced any warnings")
+	flag.IntVar(&Config.Jobs, "jobs", 1, "number of pages to render concurrently (0 for one per CPU)")
 
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "usage: gitgo [options] <git repo>\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gitgo [options] <git repo or directory of repos>...\n")
 		flag.VisitAll(func(f *flag.Flag) {
 			// Determine the flag type
 			flagType := "string"
@@ -382,13 +471,62 @@ func main() {
 	flag.Parse()
 	args := flag.Args()
 
-	if len(args) != 1 {
+	if len(args) == 0 {
 		flag.Usage()
 		return
 	}
 
-	err := run(args[0], Config.DestDir, Config.InstallDir, Config.Force)
+	// flags given on the command line override the configuration files
+	keep := setFlags(flag.CommandLine)
+	err := loadConfigFile(&Config, filepath.Join(Config.InstallDir, configFileName), keep)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repoPaths, err := findRepos(args)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(repoPaths) == 0 {
+		log.Fatal("no git repositories found")
+	}
+
+	// run points Config.DestDir at the directory of the repository it builds
+	destDir := Config.DestDir
+	siteConfig := Config
+	var warnings []Warning
+	var repos []RepoListElem
+	for _, repoPath := range repoPaths {
+		Config = siteConfig
+		err = loadRepoConfig(&Config, repoPath, keep)
+		if err != nil {
+			log.Fatalf("%s: %v", repoPath, err)
+		}
+
+		repoWarnings, err := run(repoPath, destDir, Config.InstallDir, Config.Force)
+		if err != nil {
+			log.Fatalf("%s: %v", repoPath, err)
+		}
+		for _, warning := range repoWarnings {
+			warning.Page = filepath.Join(Config.RepoName, warning.Page)
+			warnings = append(warnings, warning)
+		}
+
+		elem, err := newRepoListElem(repoPath, Config.RepoName, GlobalDataGlobal.CommitCount)
+		if err != nil {
+			warnings = append(warnings, Warning{Page: Config.RepoName, Err: err})
+		}
+		repos = append(repos, elem)
+	}
+
+	Config = siteConfig
+	err = writeSiteIndex(destDir, Config.InstallDir, repos)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printWarnings(os.Stderr, warnings)
+	if Config.Strict && len(warnings) > 0 {
+		log.Fatalf("%d warning(s) and --strict is set", len(warnings))
+	}
 }
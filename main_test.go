@@ -1,9 +1,15 @@
 package main
 
 import (
+	"encoding/xml"
 	"flag"
+	"html"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -185,8 +191,8 @@ func TestGlobalDataStructure(t *testing.T) {
 		}{
 			{"branches", "/branches.html"},
 			{"tags", "/tags.html"},
-			{"tree", "/tree"},
-			{"log", "/log"},
+			{"tree", "/tree/index.html"},
+			{"log", "/log/index.html"},
 		}
 
 		for i, expected := range expectedLinks {
@@ -364,7 +370,7 @@ func TestRunIntegration(t *testing.T) {
 		}
 
 		// Run the main logic
-		err = run(repoPath, destDir, installDir, false)
+		_, err = run(repoPath, destDir, installDir, false)
 		if err != nil {
 			t.Fatalf("run() failed: %v", err)
 		}
@@ -394,7 +400,7 @@ func TestRunIntegration(t *testing.T) {
 		installDir := tmpDir
 		nonExistentRepo := filepath.Join(tmpDir, "does-not-exist")
 
-		err := run(nonExistentRepo, destDir, installDir, false)
+		_, err := run(nonExistentRepo, destDir, installDir, false)
 		if err == nil {
 			t.Error("expected error for non-existent repository, got nil")
 		}
@@ -501,7 +507,7 @@ func TestRunIntegration(t *testing.T) {
 		}
 
 		// Run should succeed with force flag
-		err = run(repoPath, destDir, installDir, true)
+		_, err = run(repoPath, destDir, installDir, true)
 		if err != nil {
 			t.Errorf("run() with force flag failed: %v", err)
 		}
@@ -512,4 +518,708 @@ func TestRunIntegration(t *testing.T) {
 			t.Error("expected index.html to be created with force flag")
 		}
 	})
+	t.Run("incremental build prunes removed paths", func(t *testing.T) {
+		origIncremental := Config.Incremental
+		defer func() { Config.Incremental = origIncremental }()
+
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "keep.txt", "keep", "Add keep.txt")
+		createCommitInRepo(t, repo, repoPath, "gone.txt", "gone", "Add gone.txt")
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		writeTestTemplates(t, installDir, nil)
+
+		Config.Incremental = true
+
+		_, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("first run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		gonePage := filepath.Join(fullDestDir, "tree", "gone.txt.html")
+		if _, err := os.Stat(gonePage); err != nil {
+			t.Fatalf("expected %s after first run: %v", gonePage, err)
+		}
+		if _, err := os.Stat(filepath.Join(fullDestDir, manifestName)); err != nil {
+			t.Fatalf("expected manifest after first run: %v", err)
+		}
+
+		// Remove gone.txt in a new commit
+		idx, err := repo.Index()
+		if err != nil {
+			t.Fatalf("failed to get index: %v", err)
+		}
+		err = idx.RemoveByPath("gone.txt")
+		if err != nil {
+			t.Fatalf("failed to remove file from index: %v", err)
+		}
+		err = idx.Write()
+		if err != nil {
+			t.Fatalf("failed to write index: %v", err)
+		}
+		treeId, err := idx.WriteTree()
+		if err != nil {
+			t.Fatalf("failed to write tree: %v", err)
+		}
+		tree, err := repo.LookupTree(treeId)
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		head, err := repo.Head()
+		if err != nil {
+			t.Fatalf("failed to get HEAD: %v", err)
+		}
+		parent, err := repo.LookupCommit(head.Target())
+		if err != nil {
+			t.Fatalf("failed to lookup HEAD commit: %v", err)
+		}
+		sig := &git.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+		_, err = repo.CreateCommit("HEAD", sig, sig, "Remove gone.txt", tree, parent)
+		if err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+
+		// A second, incremental run must not refuse the non-empty destdir
+		_, err = run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("incremental run() failed: %v", err)
+		}
+
+		if _, err := os.Stat(gonePage); !os.IsNotExist(err) {
+			t.Error("expected page of removed file to be deleted")
+		}
+		if _, err := os.Stat(filepath.Join(fullDestDir, "tree", "keep.txt.html")); err != nil {
+			t.Errorf("expected page of kept file to remain: %v", err)
+		}
+	})
+
+	t.Run("reports template errors on single pages as warnings", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "test.txt", "test", "Test commit")
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		// file.html refers to a field that does not exist
+		writeTestTemplates(t, installDir, map[string]string{
+			"file.html": `{{define "file.html"}}{{.NoSuchField}}{{end}}`,
+		})
+
+		warnings, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		if len(warnings) != 1 {
+			t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+		}
+		if warnings[0].Page != "tree/test.txt.html" {
+			t.Errorf("expected warning for tree/test.txt.html, got %q", warnings[0].Page)
+		}
+	})
+	t.Run("generates a log and a tree for every branch and tag", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		first := createCommitInRepo(t, repo, repoPath, "old.txt", "old", "Add old.txt")
+		createCommitInRepo(t, repo, repoPath, "new.txt", "new", "Add new.txt")
+
+		firstCommit, err := repo.LookupCommit(first)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		_, err = repo.CreateBranch("feature/old", firstCommit, false)
+		if err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+		_, err = repo.Tags.CreateLightweight("v0.1", firstCommit, false)
+		if err != nil {
+			t.Fatalf("failed to create tag: %v", err)
+		}
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		writeTestTemplates(t, installDir, map[string]string{
+			"tree.html": `{{define "tree.html"}}{{range .Files}}{{.Link}} {{end}}{{end}}`,
+			"log.html":  `{{define "log.html"}}{{len .Commits}}{{end}}`,
+			"refs.html": `{{define "refs.html"}}{{range .Branches}}{{.Name}}={{.TreeLink}},{{.LogLink}} {{end}}{{range .Tags}}{{.Name}}={{.TreeLink}},{{.LogLink}} {{end}}{{end}}`,
+		})
+
+		_, err = run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		branchName := getBranchName(repo)
+
+		expectedFiles := map[string]string{
+			filepath.Join("log", branchName, "index.html"):             "2",
+			filepath.Join("log", "feature/old", "index.html"):          "1",
+			filepath.Join("log", "v0.1", "index.html"):                 "1",
+			filepath.Join("refs", "feature/old", "tree", "index.html"): "/refs/feature/old/tree/old.txt.html ",
+			filepath.Join("refs", "v0.1", "tree", "index.html"):        "/refs/v0.1/tree/old.txt.html ",
+		}
+		for file, expected := range expectedFiles {
+			contents, err := os.ReadFile(filepath.Join(fullDestDir, file))
+			if err != nil {
+				t.Errorf("expected %s to be generated: %v", file, err)
+				continue
+			}
+			if string(contents) != expected {
+				t.Errorf("%s: expected %q, got %q", file, expected, string(contents))
+			}
+		}
+
+		refs, err := os.ReadFile(filepath.Join(fullDestDir, "refs.html"))
+		if err != nil {
+			t.Fatalf("failed to read refs.html: %v", err)
+		}
+		for _, link := range []string{
+			branchName + "=/tree,/log/" + branchName,
+			"feature/old=/refs/feature/old/tree,/log/feature/old",
+			"v0.1=/refs/v0.1/tree,/log/v0.1",
+		} {
+			if !strings.Contains(string(refs), link) {
+				t.Errorf("expected refs.html to contain %q, got %q", link, string(refs))
+			}
+		}
+	})
+	t.Run("generates blame pages only for the trees of refs", func(t *testing.T) {
+		origBlame, origCommitTrees := Config.Blame, Config.CommitTrees
+		Config.Blame, Config.CommitTrees = true, true
+		defer func() { Config.Blame, Config.CommitTrees = origBlame, origCommitTrees }()
+
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		commitId := createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+		writeTestTemplates(t, installDir, nil)
+
+		_, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		if _, err := os.Stat(filepath.Join(fullDestDir, "tree", "file.txt.blame.html")); err != nil {
+			t.Errorf("expected a blame page in the tree of HEAD: %v", err)
+		}
+		commitTree := filepath.Join(fullDestDir, "commit", commitId.String(), "tree")
+		if _, err := os.Stat(filepath.Join(commitTree, "file.txt.html")); err != nil {
+			t.Errorf("expected the tree of the commit: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(commitTree, "file.txt.blame.html")); !os.IsNotExist(err) {
+			t.Errorf("expected no blame page in the tree of the commit, got %v", err)
+		}
+	})
+	t.Run("generates the tree of every commit", func(t *testing.T) {
+		origCommitTrees := Config.CommitTrees
+		Config.CommitTrees = true
+		defer func() { Config.CommitTrees = origCommitTrees }()
+
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		first := createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+		second := createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Second")
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		writeTestTemplates(t, installDir, map[string]string{
+			"file.html":   `{{define "file.html"}}{{.FileViewData.Permalink}}{{end}}`,
+			"commit.html": `{{define "commit.html"}}{{.TreeLink}}{{end}}`,
+		})
+
+		_, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		for _, id := range []*git.Oid{first, second} {
+			commitPage, err := os.ReadFile(filepath.Join(fullDestDir, "commit", id.String()+".html"))
+			if err != nil {
+				t.Fatalf("failed to read commit page: %v", err)
+			}
+			if string(commitPage) != "/commit/"+id.String()+"/tree" {
+				t.Errorf("unexpected tree link on commit page: %q", string(commitPage))
+			}
+
+			if _, err := os.Stat(filepath.Join(fullDestDir, "commit", id.String(), "tree", "index.html")); err != nil {
+				t.Errorf("expected tree of commit %s: %v", id, err)
+			}
+		}
+
+		// the file page at HEAD links to the tree of the commit that last changed it
+		filePage, err := os.ReadFile(filepath.Join(fullDestDir, "tree", "file.txt.html"))
+		if err != nil {
+			t.Fatalf("failed to read file page: %v", err)
+		}
+		expected := "/commit/" + second.String() + "/tree/file.txt.html"
+		if string(filePage) != expected {
+			t.Errorf("expected permalink %q, got %q", expected, string(filePage))
+		}
+		if _, err := os.Stat(filepath.Join(fullDestDir, strings.TrimPrefix(expected, "/"))); err != nil {
+			t.Errorf("expected permalink target to exist: %v", err)
+		}
+	})
+	t.Run("generates history pages for files and directories", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+		createCommitInRepo(t, repo, repoPath, "other.txt", "other", "Second")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Third")
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		writeTestTemplates(t, installDir, map[string]string{
+			"tree.html": `{{define "tree.html"}}{{.HistoryLink}}{{end}}`,
+			"file.html": `{{define "file.html"}}{{.FileViewData.HistoryLink}}{{end}}`,
+			"log.html":  `{{define "log.html"}}{{.Path}}:{{range .Commits}} {{.Msg}}{{end}}{{end}}`,
+		})
+
+		_, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		expectedFiles := map[string]string{
+			filepath.Join("tree", "index.html"):        "/history/index.html",
+			filepath.Join("tree", "file.txt.html"):     "/history/file.txt.html",
+			filepath.Join("history", "index.html"):     "/: Third Second First",
+			filepath.Join("history", "file.txt.html"):  "file.txt: Third First",
+			filepath.Join("history", "other.txt.html"): "other.txt: Second",
+		}
+		for file, expected := range expectedFiles {
+			contents, err := os.ReadFile(filepath.Join(fullDestDir, file))
+			if err != nil {
+				t.Errorf("expected %s to be generated: %v", file, err)
+				continue
+			}
+			if string(contents) != expected {
+				t.Errorf("%s: expected %q, got %q", file, expected, string(contents))
+			}
+		}
+	})
+
+	t.Run("paginates history pages", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Second")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "three", "Third")
+
+		origPageSize := Config.LogPageSize
+		Config.LogPageSize = 2
+		defer func() { Config.LogPageSize = origPageSize }()
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		writeTestTemplates(t, tmpDir, map[string]string{
+			"log.html": `{{define "log.html"}}{{.Pagination.Page}}/{{.Pagination.PageCount}} {{.Pagination.PrevLink}} {{.Pagination.NextLink}}:{{range .Commits}} {{.Msg}}{{end}}{{end}}`,
+		})
+
+		_, err := run(repoPath, destDir, tmpDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		historyDir := filepath.Join(destDir, filepath.Base(repoPath), "history")
+		expectedFiles := map[string]string{
+			"index.html":                                "1/2  /history/page/2.html: Third Second",
+			filepath.Join("page", "2.html"):             "2/2 /history/index.html : First",
+			"file.txt.html":                             "1/2  /history/file.txt/page/2.html: Third Second",
+			filepath.Join("file.txt", "page", "2.html"): "2/2 /history/file.txt.html : First",
+		}
+		for file, expected := range expectedFiles {
+			contents, err := os.ReadFile(filepath.Join(historyDir, file))
+			if err != nil {
+				t.Errorf("expected %s to be generated: %v", file, err)
+				continue
+			}
+			if string(contents) != expected {
+				t.Errorf("%s: expected %q, got %q", file, expected, string(contents))
+			}
+		}
+	})
+
+	t.Run("paginates the log and writes archives", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Second")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "three", "Third")
+
+		origPageSize, origArchives := Config.LogPageSize, Config.LogArchives
+		Config.LogPageSize, Config.LogArchives = 2, true
+		defer func() {
+			Config.LogPageSize, Config.LogArchives = origPageSize, origArchives
+		}()
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		installDir := tmpDir
+
+		writeTestTemplates(t, installDir, map[string]string{
+			"log.html":     `{{define "log.html"}}{{.Pagination.Page}}/{{.Pagination.PageCount}} {{.Pagination.PrevLink}} {{.Pagination.NextLink}}:{{range .Commits}} {{.Msg}}{{end}}{{end}}`,
+			"archive.html": `{{define "archive.html"}}{{range .Years}}{{.Year}} {{.Count}}{{end}}{{end}}`,
+		})
+
+		_, err := run(repoPath, destDir, installDir, false)
+		if err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		fullDestDir := filepath.Join(destDir, filepath.Base(repoPath))
+		branchName := getBranchName(repo)
+		logDir := filepath.Join(fullDestDir, "log", branchName)
+		expectedFiles := map[string]string{
+			"index.html":                    "1/2  /log/" + branchName + "/page/2.html: Third Second",
+			filepath.Join("page", "2.html"): "2/2 /log/" + branchName + "/index.html : First",
+		}
+		for file, expected := range expectedFiles {
+			contents, err := os.ReadFile(filepath.Join(logDir, file))
+			if err != nil {
+				t.Errorf("expected %s to be generated: %v", file, err)
+				continue
+			}
+			if string(contents) != expected {
+				t.Errorf("%s: expected %q, got %q", file, expected, string(contents))
+			}
+		}
+
+		contents, err := os.ReadFile(filepath.Join(logDir, "archive", "index.html"))
+		if err != nil {
+			t.Fatalf("expected the archive index to be generated: %v", err)
+		}
+		if !strings.HasSuffix(string(contents), " 3") {
+			t.Errorf("expected the archive to count 3 commits, got %q", string(contents))
+		}
+
+		feed, err := os.ReadFile(filepath.Join(fullDestDir, "atom.xml"))
+		if err != nil {
+			t.Fatalf("expected the commit feed to be generated: %v", err)
+		}
+		if strings.Count(string(feed), "<entry>") != 3 || !strings.Contains(string(feed), "<title>Third</title>") {
+			t.Errorf("expected the commit feed to list the 3 commits, got %q", string(feed))
+		}
+		if _, err := os.Stat(filepath.Join(fullDestDir, "tags.xml")); err != nil {
+			t.Errorf("expected the tag feed to be generated: %v", err)
+		}
+	})
+
+	t.Run("shows the logo only for the builds with one", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+		createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+
+		withLogo, withoutLogo := t.TempDir(), t.TempDir()
+		writeTestTemplates(t, withLogo, map[string]string{
+			"index.html": `{{define "index.html"}}logo {{.GlobalData.LogoFound}}{{end}}`,
+		})
+		writeTestTemplates(t, withoutLogo, map[string]string{
+			"index.html": `{{define "index.html"}}logo {{.GlobalData.LogoFound}}{{end}}`,
+		})
+		if err := os.WriteFile(filepath.Join(withLogo, "logo.png"), []byte("png"), 0644); err != nil {
+			t.Fatalf("failed to write logo: %v", err)
+		}
+
+		for _, tc := range []struct {
+			installDir string
+			expected   string
+		}{
+			{withLogo, "logo true"},
+			{withoutLogo, "logo false"},
+		} {
+			destDir := filepath.Join(t.TempDir(), "output")
+			if err := os.MkdirAll(destDir, 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			if _, err := run(repoPath, destDir, tc.installDir, false); err != nil {
+				t.Fatalf("run() failed: %v", err)
+			}
+			contents, err := os.ReadFile(filepath.Join(destDir, filepath.Base(repoPath), "index.html"))
+			if err != nil {
+				t.Fatalf("expected index.html to be generated: %v", err)
+			}
+			if string(contents) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, string(contents))
+			}
+		}
+	})
+
+	t.Run("links tags in the tag feed to the pages of their commits", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		first := createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+		createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Second")
+
+		commit, err := repo.LookupCommit(first)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer commit.Free()
+		sig := &git.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+		tagId, err := repo.Tags.Create("v1.0", commit, sig, "Release 1.0")
+		if err != nil {
+			t.Fatalf("failed to create tag: %v", err)
+		}
+		tag, err := repo.LookupTag(tagId)
+		if err != nil {
+			t.Fatalf("failed to lookup tag: %v", err)
+		}
+		defer tag.Free()
+		if _, err := repo.Tags.Create("v1.0-signed", tag, sig, "Signed 1.0"); err != nil {
+			t.Fatalf("failed to create tag: %v", err)
+		}
+
+		// a tag of a commit on no branch, which gets no page with the logs of
+		// the branches only
+		origRefGlob := Config.RefGlob
+		Config.RefGlob = "refs/heads/*"
+		defer func() { Config.RefGlob = origRefGlob }()
+		tree, err := commit.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		defer tree.Free()
+		sideId, err := repo.CreateCommit("", sig, sig, "Side", tree, commit)
+		if err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+		side, err := repo.LookupCommit(sideId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer side.Free()
+		if _, err := repo.Tags.Create("side", side, sig, "Side"); err != nil {
+			t.Fatalf("failed to create tag: %v", err)
+		}
+
+		tmpDir := t.TempDir()
+		destDir := filepath.Join(tmpDir, "output")
+		writeTestTemplates(t, tmpDir, nil)
+		if _, err := run(repoPath, destDir, tmpDir, false); err != nil {
+			t.Fatalf("run() failed: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(destDir, filepath.Base(repoPath), tagFeedName))
+		if err != nil {
+			t.Fatalf("expected the tag feed to be generated: %v", err)
+		}
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			t.Fatalf("failed to parse the tag feed: %v", err)
+		}
+
+		repoLink := "/" + filepath.Base(repoPath)
+		expected := map[string]string{
+			"v1.0":        repoLink + "/commit/" + first.String() + ".html",
+			"v1.0-signed": repoLink + "/commit/" + first.String() + ".html",
+			"side":        repoLink + "/tags.html",
+		}
+		if len(feed.Entries) != len(expected) {
+			t.Fatalf("expected %d entries, got %d", len(expected), len(feed.Entries))
+		}
+		for _, entry := range feed.Entries {
+			if len(entry.Links) != 1 || entry.Links[0].Href != expected[entry.Title] {
+				t.Errorf("%s: expected a link to %q, got %+v", entry.Title, expected[entry.Title], entry.Links)
+			}
+		}
+	})
+
+	t.Run("links of every page lead to generated pages", func(t *testing.T) {
+		repo, repoPath := createTestRepo(t)
+		defer repo.Free()
+
+		err := os.MkdirAll(filepath.Join(repoPath, "src"), 0755)
+		if err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		first := createCommitInRepo(t, repo, repoPath, "README.md", "# Test\n", "First")
+		createCommitInRepo(t, repo, repoPath, "src/main.go", "package main\n", "Second")
+
+		commit, err := repo.LookupCommit(first)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer commit.Free()
+		if _, err := repo.Tags.CreateLightweight("v1.0", commit, false); err != nil {
+			t.Fatalf("failed to create tag: %v", err)
+		}
+
+		// a merge of a commit on no branch, outside the first parent history
+		// walked by default, which gets no page
+		sig := &git.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+		firstTree, err := commit.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		sideId, err := repo.CreateCommit("", sig, sig, "Side", firstTree, commit)
+		if err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+		side, err := repo.LookupCommit(sideId)
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer side.Free()
+		head, err := repo.Head()
+		if err != nil {
+			t.Fatalf("failed to lookup HEAD: %v", err)
+		}
+		tip, err := repo.LookupCommit(head.Target())
+		if err != nil {
+			t.Fatalf("failed to lookup commit: %v", err)
+		}
+		defer tip.Free()
+		tipTree, err := tip.Tree()
+		if err != nil {
+			t.Fatalf("failed to lookup tree: %v", err)
+		}
+		if _, err := repo.CreateCommit("HEAD", sig, sig, "Merge", tipTree, tip, side); err != nil {
+			t.Fatalf("failed to create commit: %v", err)
+		}
+
+		origBaseUrl, origRelativeLinks := Config.BaseUrl, Config.RelativeLinks
+		defer func() { Config.BaseUrl, Config.RelativeLinks = origBaseUrl, origRelativeLinks }()
+		// with the pages left at the old tree ID paths of commit pages
+		origRedirects := Config.TreeIdRedirects
+		Config.TreeIdRedirects = true
+		defer func() { Config.TreeIdRedirects = origRedirects }()
+
+		for _, tc := range []struct {
+			name     string
+			baseUrl  string
+			relative bool
+		}{
+			{"at the domain root", "", false},
+			{"under a base path", "https://example.com/code/", false},
+			{"relative to the page", "https://example.com/code/", true},
+		} {
+			Config.BaseUrl, Config.RelativeLinks = tc.baseUrl, tc.relative
+			siteDir := filepath.Join(t.TempDir(), "output")
+
+			// an install directory without templates, for the built-in ones
+			_, err = run(repoPath, siteDir, t.TempDir(), false)
+			if err != nil {
+				t.Fatalf("%s: run() failed: %v", tc.name, err)
+			}
+			checkLinks(t, siteDir, basePath(), tc.relative)
+		}
+	})
+}
+
+// linkPattern matches the targets of the links of a page
+var linkPattern = regexp.MustCompile(`(?:href|src)="([^"]*)"`)
+
+// checkLinks checks that every link of every page and feed of the site at
+// siteDir within the site leads to a file, from the root of the site under
+// base or, when relative is set, from the page
+func checkLinks(t *testing.T, siteDir, base string, relative bool) {
+	t.Helper()
+	checked := 0
+	err := filepath.WalkDir(siteDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || (filepath.Ext(file) != ".html" && filepath.Ext(file) != ".xml") {
+			return err
+		}
+		page, err := filepath.Rel(siteDir, file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range linkPattern.FindAllStringSubmatch(string(data), -1) {
+			link := html.UnescapeString(match[1])
+			if link == "" || strings.HasPrefix(link, "#") || strings.Contains(link, ":") {
+				continue
+			}
+			if i := strings.IndexAny(link, "?#"); i >= 0 {
+				link = link[:i]
+			}
+
+			var target string
+			switch {
+			case relative && strings.HasPrefix(link, "/"):
+				t.Errorf("%s: expected a relative link, got %q", page, link)
+				continue
+			case relative:
+				target = filepath.Join(filepath.Dir(page), filepath.FromSlash(link))
+			case !strings.HasPrefix(link, base+"/"):
+				t.Errorf("%s: expected a link under %q, got %q", page, base+"/", link)
+				continue
+			default:
+				target = filepath.FromSlash(strings.TrimPrefix(link, base+"/"))
+			}
+
+			name, err := url.PathUnescape(target)
+			if err != nil {
+				t.Errorf("%s: invalid link %q: %v", page, link, err)
+				continue
+			}
+			info, err := os.Stat(filepath.Join(siteDir, name))
+			if err != nil || info.IsDir() {
+				t.Errorf("%s: link %q leads to no page", page, match[1])
+			}
+			checked++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk %s: %v", siteDir, err)
+	}
+	if checked == 0 {
+		t.Errorf("expected links to check in %s", siteDir)
+	}
+}
+
+// writeTestTemplates writes minimal templates, which render their own name,
+// to the templates directory of installDir, replaced by overrides
+func writeTestTemplates(t *testing.T, installDir string, overrides map[string]string) {
+	t.Helper()
+	templates := make(map[string]string)
+	for _, name := range []string{"index", "tree", "file", "log", "refs", "branches", "tags", "commit"} {
+		templates[name+".html"] = `{{define "` + name + `.html"}}` + name + `{{end}}`
+	}
+	for name, content := range overrides {
+		templates[name] = content
+	}
+
+	templatesDir := filepath.Join(installDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("failed to create templates dir: %v", err)
+	}
+	for name, content := range templates {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write template %s: %v", name, err)
+		}
+	}
 }
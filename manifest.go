@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// manifestName is the file in the destination directory recording what the
+// previous build rendered, so that an incremental build can skip unchanged pages
+const manifestName = ".gitgo-manifest.json"
+
+// Manifest describes the inputs every generated page was rendered from
+type Manifest struct {
+	// TemplateHash covers the templates and the site-wide settings that
+	// appear on every page; when it changes, every page is re-rendered
+	TemplateHash string `json:"template_hash"`
+	// Commits maps commit OIDs to their page, relative to the destination directory
+	Commits map[string]string `json:"commits"`
+	// Files maps tree pages, file pages and assets, relative to the
+	// destination directory, to the objects they were rendered from
+	Files map[string]ManifestEntry `json:"files"`
+	// CommitAssets maps commit OIDs to the assets their page shows and the
+	// pages of their collapsed diffs, which are kept along with the page
+	CommitAssets map[string][]string `json:"commit_assets,omitempty"`
+}
+
+type ManifestEntry struct {
+	Object     string `json:"object"`
+	LastCommit string `json:"last_commit"`
+	// Tree is the hash of the full tree shown in the sidebar of tree and
+	// file pages
+	Tree string `json:"tree,omitempty"`
+	// Nav is the hash of the neighbours and refs shown on commit pages
+	Nav string `json:"nav,omitempty"`
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		Commits:      make(map[string]string),
+		Files:        make(map[string]ManifestEntry),
+		CommitAssets: make(map[string][]string),
+	}
+}
+
+// loadManifest reads the manifest from dir
+// A missing manifest yields an empty one and found set to false
+func loadManifest(dir string) (m *Manifest, found bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return newManifest(), false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	m = newManifest()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", manifestName, err)
+	}
+	if m.Commits == nil {
+		m.Commits = make(map[string]string)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]ManifestEntry)
+	}
+	if m.CommitAssets == nil {
+		m.CommitAssets = make(map[string][]string)
+	}
+	return m, true, nil
+}
+
+// save writes the manifest to dir
+func (m *Manifest) save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestName), data, 0644)
+}
+
+// pruneStale removes the output of pages that prev rendered but m did not,
+// along with any directories left empty by the removal
+func (m *Manifest) pruneStale(prev *Manifest, dir string) error {
+	dir = filepath.Clean(dir)
+	keep := make(map[string]bool, len(m.Commits)+len(m.Files))
+	for _, page := range m.Commits {
+		keep[page] = true
+	}
+	for page := range m.Files {
+		keep[page] = true
+	}
+
+	var stale []string
+	for _, page := range prev.Commits {
+		if !keep[page] {
+			stale = append(stale, page)
+		}
+	}
+	for page := range prev.Files {
+		if !keep[page] {
+			stale = append(stale, page)
+		}
+	}
+	// deepest paths first, so that emptied directories can be removed bottom-up
+	sort.Sort(sort.Reverse(sort.StringSlice(stale)))
+
+	for _, page := range stale {
+		path := filepath.Join(dir, page)
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for parent := filepath.Dir(path); parent != dir && parent != "."; parent = filepath.Dir(parent) {
+			empty, err := isDirEmpty(parent)
+			if err != nil || !empty {
+				break
+			}
+			if err := os.Remove(parent); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keepPrefix copies the entries of prev for the pages below prefix into m,
+// and reports whether there were any
+func (m *Manifest) keepPrefix(prev *Manifest, prefix string) bool {
+	kept := false
+	for page, entry := range prev.Files {
+		if strings.HasPrefix(page, prefix) {
+			m.Files[page] = entry
+			kept = true
+		}
+	}
+	return kept
+}
+
+// commitUpToDate reports whether the page of commit id from the previous
+// build can be kept as is
+func commitUpToDate(id, page string) bool {
+	if !Config.Incremental || GlobalPrevManifest.TemplateHash != GlobalManifest.TemplateHash {
+		return false
+	}
+	if GlobalPrevManifest.Commits[id] != page {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(Config.DestDir, page))
+	return err == nil
+}
+
+// pageUpToDate reports whether a tree page, file page or asset from the
+// previous build was rendered from the same inputs and can be kept as is
+func pageUpToDate(page string, entry ManifestEntry) bool {
+	if !Config.Incremental || GlobalPrevManifest.TemplateHash != GlobalManifest.TemplateHash {
+		return false
+	}
+	prev, ok := GlobalPrevManifest.Files[page]
+	if !ok || prev != entry {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(Config.DestDir, page))
+	return err == nil
+}
+
+// hashTemplates returns a hash of every template and static asset, from dir
+// or built in, together with the given site-wide settings
+func hashTemplates(dir string, settings ...string) (string, error) {
+	names, err := templateNames(dir)
+	if err != nil {
+		return "", err
+	}
+	names = append(names, "styles.css", "js/main.js")
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		data, err := readTemplateFile(dir, name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(data))
+		h.Write(data)
+	}
+	for _, setting := range settings {
+		fmt.Fprintf(h, "%s\x00", setting)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outputSettings returns every setting of c that changes what the pages of a
+// repository contain or link to, for hashTemplates
+func outputSettings(c *ConfigStruct) []string {
+	return []string{
+		c.GitUrl, strconv.Itoa(c.MaxSummaryLen), c.SubmoduleBaseUrl, c.RefGlob,
+		strconv.FormatBool(c.TreeIdRedirects), strconv.FormatBool(c.CommitTrees),
+		strconv.FormatBool(c.Blame), strconv.FormatBool(c.AllParents),
+		strconv.FormatBool(c.SplitDiffs), strconv.Itoa(c.DiffMaxLines),
+		strconv.Itoa(c.DiffMaxBytes), strconv.Itoa(c.DiffMaxFiles),
+		c.BaseUrl, strconv.FormatBool(c.RelativeLinks), strconv.Itoa(c.FeedEntries),
+		c.HighlightStyle, strings.Join(c.Excludes, "\x00"),
+		strconv.Itoa(c.LogPageSize), strconv.FormatBool(c.LogArchives),
+	}
+}
+
+// hashFullTree returns a hash of the flattened tree shown in the sidebar
+func hashFullTree(items []FlatTreeItem) string {
+	h := sha256.New()
+	for _, item := range items {
+		fmt.Fprintf(h, "%s\x00%d\x00%t\n", item.Link, item.Depth, item.IsFile)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashCommitNav returns a hash of the commits and refs shown around a commit
+func hashCommitNav(nav CommitNav) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\n", nav.PrevLink, nav.NextLink, nav.Describe)
+	for _, ref := range nav.ContainedIn {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", ref.RefName, ref.LogLink, ref.TreeLink)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keepCommitAssets copies the assets that prev recorded for the page of
+// commit id into m
+func (m *Manifest) keepCommitAssets(prev *Manifest, id string) {
+	assets, ok := prev.CommitAssets[id]
+	if !ok {
+		return
+	}
+	m.CommitAssets[id] = assets
+	for _, page := range assets {
+		if entry, ok := prev.Files[page]; ok {
+			m.Files[page] = entry
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	t.Run("returns empty manifest when none exists", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		m, found, err := loadManifest(tmpDir)
+		if err != nil {
+			t.Fatalf("loadManifest() failed: %v", err)
+		}
+		if found {
+			t.Error("expected found to be false")
+		}
+		if len(m.Commits) != 0 || len(m.Files) != 0 {
+			t.Error("expected empty manifest")
+		}
+	})
+
+	t.Run("round-trips a saved manifest", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		m := newManifest()
+		m.TemplateHash = "abc"
+		m.Commits["1234"] = "commit/1234.html"
+		m.Files["tree/README.md.html"] = ManifestEntry{Object: "5678", LastCommit: "/commit/1234.html", Tree: "def"}
+
+		err := m.save(tmpDir)
+		if err != nil {
+			t.Fatalf("save() failed: %v", err)
+		}
+
+		loaded, found, err := loadManifest(tmpDir)
+		if err != nil {
+			t.Fatalf("loadManifest() failed: %v", err)
+		}
+		if !found {
+			t.Fatal("expected found to be true")
+		}
+		if loaded.TemplateHash != "abc" {
+			t.Errorf("unexpected template hash: %q", loaded.TemplateHash)
+		}
+		if loaded.Commits["1234"] != "commit/1234.html" {
+			t.Errorf("unexpected commit page: %q", loaded.Commits["1234"])
+		}
+		if loaded.Files["tree/README.md.html"] != m.Files["tree/README.md.html"] {
+			t.Errorf("unexpected file entry: %+v", loaded.Files["tree/README.md.html"])
+		}
+	})
+
+	t.Run("fails on corrupt manifest", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		err := os.WriteFile(filepath.Join(tmpDir, manifestName), []byte("{not json"), 0644)
+		if err != nil {
+			t.Fatalf("failed to write manifest: %v", err)
+		}
+
+		_, _, err = loadManifest(tmpDir)
+		if err == nil {
+			t.Error("expected error for corrupt manifest, got nil")
+		}
+	})
+}
+
+func TestPruneStale(t *testing.T) {
+	t.Run("removes pages that no longer exist", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		pages := []string{
+			"commit/old.html",
+			"commit/new.html",
+			"tree/kept.txt.html",
+			"tree/gone/file.txt.html",
+			"tree/gone/index.html",
+		}
+		for _, page := range pages {
+			path := filepath.Join(tmpDir, page)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("failed to create dir: %v", err)
+			}
+			if err := os.WriteFile(path, []byte("page"), 0644); err != nil {
+				t.Fatalf("failed to write page: %v", err)
+			}
+		}
+
+		prev := newManifest()
+		prev.Commits["old"] = "commit/old.html"
+		prev.Files["tree/kept.txt.html"] = ManifestEntry{Object: "1"}
+		prev.Files["tree/gone/file.txt.html"] = ManifestEntry{Object: "2"}
+		prev.Files["tree/gone/index.html"] = ManifestEntry{Object: "3"}
+
+		cur := newManifest()
+		cur.Commits["new"] = "commit/new.html"
+		cur.Files["tree/kept.txt.html"] = ManifestEntry{Object: "1"}
+
+		err := cur.pruneStale(prev, tmpDir)
+		if err != nil {
+			t.Fatalf("pruneStale() failed: %v", err)
+		}
+
+		for _, page := range []string{"commit/old.html", "tree/gone"} {
+			if _, err := os.Stat(filepath.Join(tmpDir, page)); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed", page)
+			}
+		}
+		for _, page := range []string{"commit/new.html", "tree/kept.txt.html"} {
+			if _, err := os.Stat(filepath.Join(tmpDir, page)); err != nil {
+				t.Errorf("expected %s to be kept: %v", page, err)
+			}
+		}
+	})
+
+	t.Run("keeps pages shared with a current commit", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		err := os.MkdirAll(filepath.Join(tmpDir, "commit"), 0755)
+		if err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(tmpDir, "commit", "shared.html"), []byte("page"), 0644)
+		if err != nil {
+			t.Fatalf("failed to write page: %v", err)
+		}
+
+		prev := newManifest()
+		prev.Commits["a"] = "commit/shared.html"
+		cur := newManifest()
+		cur.Commits["b"] = "commit/shared.html"
+
+		err = cur.pruneStale(prev, tmpDir)
+		if err != nil {
+			t.Fatalf("pruneStale() failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(tmpDir, "commit", "shared.html")); err != nil {
+			t.Errorf("expected shared page to be kept: %v", err)
+		}
+	})
+}
+
+func TestHashTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	templatesDir := filepath.Join(tmpDir, "templates")
+	err := os.MkdirAll(templatesDir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create templates dir: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(templatesDir, "index.html"), []byte("one"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	first, err := hashTemplates(templatesDir, "main")
+	if err != nil {
+		t.Fatalf("hashTemplates() failed: %v", err)
+	}
+
+	again, err := hashTemplates(templatesDir, "main")
+	if err != nil {
+		t.Fatalf("hashTemplates() failed: %v", err)
+	}
+	if first != again {
+		t.Error("expected identical hashes for identical inputs")
+	}
+
+	otherSetting, err := hashTemplates(templatesDir, "master")
+	if err != nil {
+		t.Fatalf("hashTemplates() failed: %v", err)
+	}
+	if first == otherSetting {
+		t.Error("expected hash to change with settings")
+	}
+
+	err = os.WriteFile(filepath.Join(templatesDir, "index.html"), []byte("two"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	changed, err := hashTemplates(templatesDir, "main")
+	if err != nil {
+		t.Fatalf("hashTemplates() failed: %v", err)
+	}
+	if first == changed {
+		t.Error("expected hash to change with template contents")
+	}
+}
+
+func TestHashFullTree(t *testing.T) {
+	a := []FlatTreeItem{{Name: "a.txt", Link: "/tree/a.txt.html", IsFile: true}}
+	b := []FlatTreeItem{{Name: "b.txt", Link: "/tree/b.txt.html", IsFile: true}}
+
+	if hashFullTree(a) != hashFullTree(a) {
+		t.Error("expected identical hashes for identical trees")
+	}
+	if hashFullTree(a) == hashFullTree(b) {
+		t.Error("expected different hashes for different trees")
+	}
+}
+
+func TestHashCommitNav(t *testing.T) {
+	a := CommitNav{PrevLink: "/commit/1.html", NextLink: "/commit/3.html"}
+	b := a
+	b.ContainedIn = []RefListElem{{RefName: "refs/heads/main"}}
+	c := a
+	c.Describe = "v1.0-1-g2222222"
+
+	if hashCommitNav(a) != hashCommitNav(a) {
+		t.Error("expected identical hashes for identical navigation")
+	}
+	if hashCommitNav(a) == hashCommitNav(b) || hashCommitNav(a) == hashCommitNav(c) {
+		t.Error("expected different hashes when the refs or the description change")
+	}
+}
+
+func TestKeepPrefix(t *testing.T) {
+	prev := newManifest()
+	prev.Files["commit/abc/tree/index.html"] = ManifestEntry{Object: "1"}
+	prev.Files["commit/abc/tree/a.txt.html"] = ManifestEntry{Object: "2"}
+	prev.Files["commit/abcd/tree/index.html"] = ManifestEntry{Object: "3"}
+
+	m := newManifest()
+	if !m.keepPrefix(prev, "commit/abc/tree/") {
+		t.Fatal("expected entries to be kept")
+	}
+	if len(m.Files) != 2 {
+		t.Errorf("expected 2 entries, got %d: %v", len(m.Files), m.Files)
+	}
+	if _, ok := m.Files["commit/abcd/tree/index.html"]; ok {
+		t.Error("expected entries of other commits not to be kept")
+	}
+
+	if m.keepPrefix(prev, "commit/def/tree/") {
+		t.Error("expected nothing to be kept for an unknown prefix")
+	}
+}
+
+func TestKeepCommitAssets(t *testing.T) {
+	prev := newManifest()
+	prev.Files["assets/blobs/1.png"] = ManifestEntry{Object: "1"}
+	prev.Files["assets/blobs/2.png"] = ManifestEntry{Object: "2"}
+	prev.Files["assets/blobs/3.png"] = ManifestEntry{Object: "3"}
+	prev.CommitAssets["abc"] = []string{"assets/blobs/1.png", "assets/blobs/2.png"}
+	prev.CommitAssets["def"] = []string{"assets/blobs/3.png"}
+
+	m := newManifest()
+	m.keepCommitAssets(prev, "abc")
+	m.keepCommitAssets(prev, "unknown")
+
+	if len(m.Files) != 2 || m.Files["assets/blobs/2.png"].Object != "2" {
+		t.Errorf("expected the 2 assets of abc to be kept, got %v", m.Files)
+	}
+	if len(m.CommitAssets) != 1 || len(m.CommitAssets["abc"]) != 2 {
+		t.Errorf("expected the assets of abc to be recorded, got %v", m.CommitAssets)
+	}
+}
+
+func TestOutputSettings(t *testing.T) {
+	// the settings that only change how or where a build runs
+	unhashed := map[string]bool{
+		"RepoName": true, "InstallDir": true, "TemplatesDir": true, "DestDir": true,
+		"Force": true, "Incremental": true, "Jobs": true, "Strict": true,
+	}
+
+	base := Config
+	expected := fmt.Sprint(outputSettings(&base))
+	typ := reflect.TypeOf(base)
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Name
+		if unhashed[name] {
+			continue
+		}
+
+		c := base
+		c.Excludes = append([]string(nil), base.Excludes...)
+		field := reflect.ValueOf(&c).Elem().Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(field.String() + "x")
+		case reflect.Int:
+			field.SetInt(field.Int() + 1)
+		case reflect.Bool:
+			field.SetBool(!field.Bool())
+		case reflect.Slice:
+			field.Set(reflect.Append(field, reflect.ValueOf("x")))
+		default:
+			t.Fatalf("unexpected kind of setting %s", name)
+		}
+
+		if fmt.Sprint(outputSettings(&c)) == expected {
+			t.Errorf("expected a change of %s to change the settings hashed", name)
+		}
+	}
+}
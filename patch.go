@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// patchStatWidth is the widest bar of the diffstat of a patch email
+const patchStatWidth = 50
+
+// patchFileStat is a line of the diffstat of a patch email
+type patchFileStat struct {
+	Name      string
+	Additions int
+	Deletions int
+	Binary    bool
+}
+
+// splitPatchFiles splits a diff of several files, as written by
+// DiffFormatPatch, at the "diff --git" line starting each file
+func splitPatchFiles(diff string) []string {
+	var files []string
+	start := -1
+	for offset := 0; offset < len(diff); {
+		end := strings.IndexByte(diff[offset:], '\n')
+		if end < 0 {
+			end = len(diff)
+		} else {
+			end += offset + 1
+		}
+		if strings.HasPrefix(diff[offset:], "diff --git ") {
+			if start >= 0 {
+				files = append(files, diff[start:offset])
+			}
+			start = offset
+		}
+		offset = end
+	}
+	if start >= 0 {
+		files = append(files, diff[start:])
+	}
+	return files
+}
+
+// patchStat returns the diffstat line of the diff of a single file
+func patchStat(text string) patchFileStat {
+	patch := parsePatch(text)
+	stat := patchFileStat{Additions: patch.Additions, Deletions: patch.Deletions}
+
+	var oldName, newName, renameFrom, renameTo string
+	for _, line := range patch.Header {
+		switch {
+		case strings.HasPrefix(line, "rename from "):
+			renameFrom = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			renameTo = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "--- a/"):
+			oldName = strings.TrimPrefix(line, "--- a/")
+		case strings.HasPrefix(line, "+++ b/"):
+			newName = strings.TrimPrefix(line, "+++ b/")
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			stat.Binary = true
+		case strings.HasPrefix(line, "diff --git a/"):
+			// the fallback for diffs without --- and +++ lines, such as
+			// mode changes, which is ambiguous for paths with spaces
+			a, b, _ := strings.Cut(strings.TrimPrefix(line, "diff --git a/"), " b/")
+			if oldName == "" {
+				oldName = a
+			}
+			if newName == "" {
+				newName = b
+			}
+		}
+	}
+
+	switch {
+	case renameFrom != "" && renameTo != "":
+		stat.Name = renameFrom + " => " + renameTo
+	case newName != "":
+		stat.Name = newName
+	default:
+		stat.Name = oldName
+	}
+	return stat
+}
+
+// formatDiffStat returns the diffstat of a patch email, in the format of
+// git format-patch
+func formatDiffStat(stats []patchFileStat) string {
+	nameWidth, largest := 0, 0
+	for _, stat := range stats {
+		nameWidth = max(nameWidth, len(stat.Name))
+		largest = max(largest, stat.Additions+stat.Deletions)
+	}
+	countWidth := len(fmt.Sprint(largest))
+
+	var b strings.Builder
+	additions, deletions := 0, 0
+	for _, stat := range stats {
+		additions += stat.Additions
+		deletions += stat.Deletions
+		if stat.Binary {
+			fmt.Fprintf(&b, " %-*s | Bin\n", nameWidth, stat.Name)
+			continue
+		}
+
+		plus, minus := stat.Additions, stat.Deletions
+		if largest > patchStatWidth {
+			plus = plus * patchStatWidth / largest
+			minus = minus * patchStatWidth / largest
+		}
+		fmt.Fprintf(&b, " %-*s | %*d %s%s\n", nameWidth, stat.Name, countWidth,
+			stat.Additions+stat.Deletions, strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	fmt.Fprintf(&b, " %s changed", plural(len(stats), "file"))
+	if additions > 0 || deletions == 0 {
+		fmt.Fprintf(&b, ", %s(+)", plural(additions, "insertion"))
+	}
+	if deletions > 0 {
+		fmt.Fprintf(&b, ", %s(-)", plural(deletions, "deletion"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// encodeHeader encodes a header value for an email, as RFC 2047 words when it
+// is not plain ASCII
+func encodeHeader(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// formatPatchEmail returns a commit as a patch email in the mbox format of
+// git format-patch, which git am applies
+func formatPatchEmail(id, authorName, authorEmail string, date time.Time, message, diff string) string {
+	subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	// the subject is the first paragraph, joined into a line
+	for {
+		line, rest, found := strings.Cut(body, "\n")
+		if strings.TrimSpace(line) == "" {
+			body = rest
+			break
+		}
+		subject += " " + strings.TrimSpace(line)
+		if !found {
+			body = ""
+			break
+		}
+		body = rest
+	}
+	body = strings.TrimSpace(body)
+
+	var stats []patchFileStat
+	for _, file := range splitPatchFiles(diff) {
+		stats = append(stats, patchStat(file))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s Mon Sep 17 00:00:00 2001\n", id)
+	fmt.Fprintf(&b, "From: %s <%s>\n", encodeHeader(authorName), authorEmail)
+	fmt.Fprintf(&b, "Date: %s\n", date.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(&b, "Subject: [PATCH] %s\n", encodeHeader(strings.TrimSpace(subject)))
+	b.WriteString("MIME-Version: 1.0\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\n")
+	b.WriteString("\n")
+	if body != "" {
+		b.WriteString(body + "\n")
+	}
+	b.WriteString("---\n")
+	if len(stats) > 0 {
+		b.WriteString(formatDiffStat(stats))
+	}
+	b.WriteString("\n")
+	b.WriteString(diff)
+	b.WriteString("-- \ngitgo\n")
+	return b.String()
+}
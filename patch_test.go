@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRawDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+-var a = 1
++var a = 10
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..3333333
+Binary files /dev/null and b/logo.png differ
+`
+
+func TestSplitPatchFiles(t *testing.T) {
+	files := splitPatchFiles(testRawDiff)
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %d: %q", len(files), files)
+	}
+	if strings.Join(files, "") != testRawDiff {
+		t.Errorf("expected the files to make up the whole diff")
+	}
+	if !strings.HasPrefix(files[1], "diff --git a/old.txt b/new.txt\n") {
+		t.Errorf("unexpected second file %q", files[1])
+	}
+
+	if files := splitPatchFiles(""); files != nil {
+		t.Errorf("expected no files for an empty diff, got %q", files)
+	}
+}
+
+func TestPatchStat(t *testing.T) {
+	var stats []patchFileStat
+	for _, file := range splitPatchFiles(testRawDiff) {
+		stats = append(stats, patchStat(file))
+	}
+
+	expected := []patchFileStat{
+		{Name: "main.go", Additions: 1, Deletions: 1},
+		{Name: "old.txt => new.txt"},
+		{Name: "logo.png", Binary: true},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestFormatDiffStat(t *testing.T) {
+	stat := formatDiffStat([]patchFileStat{
+		{Name: "main.go", Additions: 10, Deletions: 2},
+		{Name: "a.go", Additions: 1},
+		{Name: "logo.png", Binary: true},
+	})
+
+	expected := ` main.go  | 12 ++++++++++--
+ a.go     |  1 +
+ logo.png | Bin
+ 3 files changed, 11 insertions(+), 2 deletions(-)
+`
+	if stat != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stat)
+	}
+
+	// bars are scaled down to the widest
+	stat = formatDiffStat([]patchFileStat{{Name: "big", Additions: 200}})
+	if !strings.Contains(stat, "| 200 "+strings.Repeat("+", patchStatWidth)+"\n") {
+		t.Errorf("expected a scaled bar, got %q", stat)
+	}
+	if !strings.HasSuffix(stat, " 1 file changed, 200 insertions(+)\n") {
+		t.Errorf("unexpected summary %q", stat)
+	}
+}
+
+func TestFormatPatchEmail(t *testing.T) {
+	date := time.Date(2024, 3, 5, 14, 30, 0, 0, time.FixedZone("", 3600))
+	message := "Fix the thing\nacross two lines\n\nLonger explanation\nof the fix.\n"
+	email := formatPatchEmail("abc123", "Jöhn Doe", "john@example.com", date, message, testRawDiff)
+
+	for _, want := range []string{
+		"From abc123 Mon Sep 17 00:00:00 2001\n",
+		"From: =?utf-8?q?J=C3=B6hn_Doe?= <john@example.com>\n",
+		"Date: Tue, 5 Mar 2024 14:30:00 +0100\n",
+		"Subject: [PATCH] Fix the thing across two lines\n",
+		"\n\nLonger explanation\nof the fix.\n---\n main.go",
+		" 3 files changed, 1 insertion(+), 1 deletion(-)\n\ndiff --git a/main.go b/main.go\n",
+	} {
+		if !strings.Contains(email, want) {
+			t.Errorf("expected %q in\n%s", want, email)
+		}
+	}
+	if !strings.HasSuffix(email, "differ\n-- \ngitgo\n") {
+		t.Errorf("expected the diff and the signature at the end, got\n%s", email)
+	}
+
+	// a commit with only a subject has no body
+	email = formatPatchEmail("abc123", "John", "john@example.com", date, "Subject only", "")
+	if !strings.Contains(email, "Subject: [PATCH] Subject only\n") || !strings.Contains(email, "8bit\n\n---\n\n-- \n") {
+		t.Errorf("unexpected email for a commit without a body or diff:\n%s", email)
+	}
+}
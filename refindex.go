@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// refNode is a commit of the history of the refs with its parents
+type refNode struct {
+	Id      string
+	Parents []string
+}
+
+// nearestTag is the closest tag a commit descends from, and the number of
+// commits on the shortest path from the commit down to it
+type nearestTag struct {
+	Tag      string
+	Distance int
+}
+
+// refIndex records, for every commit reachable from the branches and tags,
+// the refs that contain it and the nearest tag it descends from
+type refIndex struct {
+	refs     []RefListElem
+	contains map[string][]uint64 // a bit per ref of refs
+	nearest  map[string]nearestTag
+}
+
+// buildRefIndex walks the history of head and of the given refs once and
+// indexes the refs containing each commit and the nearest tag of each
+// Refs that do not point to commits are left out with a warning
+func buildRefIndex(repo *git.Repository, head *git.Oid, branches, tags []RefListElem) (*refIndex, error) {
+	walk, err := repo.Walk()
+	if err != nil {
+		return nil, err
+	}
+	defer walk.Free()
+	// children before their parents
+	walk.Sorting(git.SortTopological)
+
+	if err = walk.Push(head); err != nil {
+		return nil, err
+	}
+	refs := make([]RefListElem, 0, len(branches)+len(tags))
+	for _, ref := range append(append([]RefListElem{}, branches...), tags...) {
+		target, err := git.NewOid(ref.Target)
+		if err == nil {
+			err = walk.Push(target)
+		}
+		if err != nil {
+			GlobalWarnings.add(ref.RefName, err)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+
+	var nodes []refNode
+	id := git.Oid{}
+	for walk.Next(&id) == nil {
+		commit, err := repo.LookupCommit(&id)
+		if err != nil {
+			return nil, err
+		}
+		node := refNode{Id: id.String(), Parents: make([]string, commit.ParentCount())}
+		for i := range node.Parents {
+			node.Parents[i] = commit.ParentId(uint(i)).String()
+		}
+		commit.Free()
+		nodes = append(nodes, node)
+	}
+
+	return &refIndex{
+		refs:     refs,
+		contains: containingRefs(nodes, refs),
+		nearest:  nearestTags(nodes, refs),
+	}, nil
+}
+
+// containingRefs returns a set of refs, as bits over refs, for every commit
+// of nodes, which lists children before their parents
+// Each commit is contained by the refs pointing to it and by those
+// containing any of its children
+func containingRefs(nodes []refNode, refs []RefListElem) map[string][]uint64 {
+	words := (len(refs) + 63) / 64
+	contains := make(map[string][]uint64, len(nodes))
+	set := func(id string) []uint64 {
+		bits, ok := contains[id]
+		if !ok {
+			bits = make([]uint64, words)
+			contains[id] = bits
+		}
+		return bits
+	}
+
+	for i, ref := range refs {
+		set(ref.Target)[i/64] |= 1 << (i % 64)
+	}
+	for _, node := range nodes {
+		bits := set(node.Id)
+		for _, parent := range node.Parents {
+			parentBits := set(parent)
+			for w := range parentBits {
+				parentBits[w] |= bits[w]
+			}
+		}
+	}
+	return contains
+}
+
+// nearestTags returns the nearest tag of the tags among refs for every
+// commit of nodes, which lists children before their parents
+// The distance is the shortest path down to the tag, which approximates the
+// count of git describe without walking the history once per commit
+func nearestTags(nodes []refNode, refs []RefListElem) map[string]nearestTag {
+	nearest := make(map[string]nearestTag, len(nodes))
+	tagged := make(map[string]string)
+	for _, ref := range refs {
+		if _, ok := tagged[ref.Target]; ref.Type == "tag" && !ok {
+			tagged[ref.Target] = ref.Name
+		}
+	}
+
+	// parents before their children
+	for i := len(nodes) - 1; i >= 0; i-- {
+		node := nodes[i]
+		if tag, ok := tagged[node.Id]; ok {
+			nearest[node.Id] = nearestTag{Tag: tag}
+			continue
+		}
+		best, found := nearestTag{}, false
+		for _, parent := range node.Parents {
+			if candidate, ok := nearest[parent]; ok && (!found || candidate.Distance+1 < best.Distance) {
+				best, found = nearestTag{Tag: candidate.Tag, Distance: candidate.Distance + 1}, true
+			}
+		}
+		if found {
+			nearest[node.Id] = best
+		}
+	}
+	return nearest
+}
+
+// containing returns the branches and tags that contain commit id
+func (ri *refIndex) containing(id string) []RefListElem {
+	if ri == nil {
+		return nil
+	}
+	var refs []RefListElem
+	bits := ri.contains[id]
+	for i, ref := range ri.refs {
+		if i/64 < len(bits) && bits[i/64]&(1<<(i%64)) != 0 {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// describe names commit id after its nearest tag in the format of
+// git describe, such as "v1.2-3-gabcdef1", or returns nothing for commits
+// without a tag below them
+func (ri *refIndex) describe(id string) string {
+	if ri == nil {
+		return ""
+	}
+	nearest, ok := ri.nearest[id]
+	switch {
+	case !ok:
+		return ""
+	case nearest.Distance == 0:
+		return nearest.Tag
+	default:
+		return fmt.Sprintf("%s-%d-g%s", nearest.Tag, nearest.Distance, id[:7])
+	}
+}
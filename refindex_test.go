@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testRefNodes is a history with a merge, newest first:
+//
+//	e (main)
+//	|\
+//	d c (topic)
+//	|/
+//	b (v1.0)
+//	a (v0.1)
+var testRefNodes = []refNode{
+	{Id: "eeeeeeeeee", Parents: []string{"dddddddddd", "cccccccccc"}},
+	{Id: "dddddddddd", Parents: []string{"bbbbbbbbbb"}},
+	{Id: "cccccccccc", Parents: []string{"bbbbbbbbbb"}},
+	{Id: "bbbbbbbbbb", Parents: []string{"aaaaaaaaaa"}},
+	{Id: "aaaaaaaaaa"},
+}
+
+var testRefs = []RefListElem{
+	{Name: "main", Type: "branch", Target: "eeeeeeeeee"},
+	{Name: "topic", Type: "branch", Target: "cccccccccc"},
+	{Name: "v0.1", Type: "tag", Target: "aaaaaaaaaa"},
+	{Name: "v1.0", Type: "tag", Target: "bbbbbbbbbb"},
+}
+
+func TestContainingRefs(t *testing.T) {
+	ri := &refIndex{refs: testRefs, contains: containingRefs(testRefNodes, testRefs)}
+	names := func(refs []RefListElem) []string {
+		var result []string
+		for _, ref := range refs {
+			result = append(result, ref.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		id       string
+		expected []string
+	}{
+		{"eeeeeeeeee", []string{"main"}},
+		{"dddddddddd", []string{"main"}},
+		{"cccccccccc", []string{"main", "topic"}},
+		{"bbbbbbbbbb", []string{"main", "topic", "v1.0"}},
+		{"aaaaaaaaaa", []string{"main", "topic", "v0.1", "v1.0"}},
+		{"ffffffffff", nil},
+	}
+
+	for _, tc := range tests {
+		if got := names(ri.containing(tc.id)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.id, tc.expected, got)
+		}
+	}
+
+	var nilIndex *refIndex
+	if nilIndex.containing("aaaaaaaaaa") != nil {
+		t.Errorf("expected no refs without an index")
+	}
+}
+
+func TestContainingRefsManyRefs(t *testing.T) {
+	var refs []RefListElem
+	for i := 0; i < 130; i++ {
+		refs = append(refs, RefListElem{Name: string(rune('a' + i%26)), Target: "bbbbbbbbbb"})
+	}
+	ri := &refIndex{refs: refs, contains: containingRefs(testRefNodes, refs)}
+
+	if got := len(ri.containing("aaaaaaaaaa")); got != 130 {
+		t.Errorf("expected all 130 refs to contain the root, got %d", got)
+	}
+	if got := len(ri.containing("cccccccccc")); got != 0 {
+		t.Errorf("expected no refs to contain the topic, got %d", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	ri := &refIndex{refs: testRefs, nearest: nearestTags(testRefNodes, testRefs)}
+
+	tests := []struct {
+		id       string
+		expected string
+	}{
+		{"eeeeeeeeee", "v1.0-2-geeeeeee"},
+		{"dddddddddd", "v1.0-1-gddddddd"},
+		{"bbbbbbbbbb", "v1.0"},
+		{"aaaaaaaaaa", "v0.1"},
+		{"ffffffffff", ""},
+	}
+
+	for _, tc := range tests {
+		if got := ri.describe(tc.id); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.id, tc.expected, got)
+		}
+	}
+
+	var nilIndex *refIndex
+	if nilIndex.describe("aaaaaaaaaa") != "" {
+		t.Errorf("expected no description without an index")
+	}
+}
+
+func TestBuildRefIndex(t *testing.T) {
+	repo, repoPath := createTestRepo(t)
+	defer repo.Free()
+
+	firstId := createCommitInRepo(t, repo, repoPath, "file.txt", "one", "First")
+	headId := createCommitInRepo(t, repo, repoPath, "file.txt", "two", "Second")
+
+	first, err := repo.LookupCommit(firstId)
+	if err != nil {
+		t.Fatalf("failed to lookup commit: %v", err)
+	}
+	defer first.Free()
+	if _, err := repo.Tags.CreateLightweight("v1.0", first, false); err != nil {
+		t.Fatalf("failed to create tag: %v", err)
+	}
+
+	ri, err := buildRefIndex(repo, headId, getBranches(repo), getTags(repo))
+	if err != nil {
+		t.Fatalf("buildRefIndex() failed: %v", err)
+	}
+
+	if got := len(ri.containing(firstId.String())); got != 2 {
+		t.Errorf("expected the branch and the tag to contain the first commit, got %d refs", got)
+	}
+	if refs := ri.containing(headId.String()); len(refs) != 1 || refs[0].Type != "branch" {
+		t.Errorf("expected only the branch to contain the head, got %+v", refs)
+	}
+	if got, expected := ri.describe(headId.String()), "v1.0-1-g"+headId.String()[:7]; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// refIncluded reports whether pages are generated for the ref with the given
+// full name, such as "refs/heads/main"
+// Without Config.RefGlob every branch and tag is included
+func refIncluded(refName string) bool {
+	if Config.RefGlob == "" {
+		return true
+	}
+	matched, err := path.Match(Config.RefGlob, refName)
+	return err == nil && matched
+}
+
+// selectRefPages decides which branches and tags get a log and a tree of
+// their own, fills in their links and returns the refs whose pages still have
+// to be generated
+// The current branch links to the log and tree generated for HEAD. Branches
+// come before tags, so a tag with the name of a branch gets no pages
+func selectRefPages(repo *git.Repository, branches, tags []RefListElem, current string) []RefListElem {
+	var selected []RefListElem
+	taken := map[string]bool{current: true}
+
+	link := func(ref *RefListElem) {
+		if ref.Type == "branch" && ref.Name == current {
+			ref.LogLink = "/log/" + current
+			ref.TreeLink = "/tree"
+			return
+		}
+		if !refIncluded(ref.RefName) {
+			return
+		}
+		if taken[ref.Name] {
+			GlobalWarnings.add(path.Join("refs", ref.Name), fmt.Errorf("%s: ref name is ambiguous, skipping", ref.RefName))
+			return
+		}
+
+		// annotated tags may point to objects other than commits
+		oid, err := git.NewOid(ref.Target)
+		if err != nil {
+			GlobalWarnings.add(path.Join("refs", ref.Name), err)
+			return
+		}
+		commit, err := repo.LookupCommit(oid)
+		if err != nil {
+			GlobalWarnings.add(path.Join("refs", ref.Name), fmt.Errorf("%s: %w", ref.RefName, err))
+			return
+		}
+		commit.Free()
+
+		taken[ref.Name] = true
+		ref.LogLink = "/log/" + ref.Name
+		ref.TreeLink = "/refs/" + ref.Name + "/tree"
+		selected = append(selected, *ref)
+	}
+
+	for i := range branches {
+		link(&branches[i])
+	}
+	for i := range tags {
+		link(&tags[i])
+	}
+	return selected
+}
+
+// generateRefPages generates the log and the tree of every given ref
+func generateRefPages(repo *git.Repository, refs []RefListElem) error {
+	for _, ref := range refs {
+		head, err := git.NewOid(ref.Target)
+		if err != nil {
+			return err
+		}
+
+		commitlist, err := getCommitLog(repo, head)
+		if err != nil {
+			return err
+		}
+		err = writeLog(ref.Name, ref.Target, commitlist)
+		if err != nil {
+			return err
+		}
+
+		rh, err := refHistoryFor(repo, head)
+		if err != nil {
+			return err
+		}
+		err = indexTree(repo, head, ref.TreeLink, rh.Index, rh.History)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ref.RefName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRefIncluded(t *testing.T) {
+	origRefGlob := Config.RefGlob
+	defer func() { Config.RefGlob = origRefGlob }()
+
+	tests := []struct {
+		glob     string
+		refName  string
+		expected bool
+	}{
+		{"", "refs/heads/main", true},
+		{"", "refs/tags/v1.0", true},
+		{"refs/heads/*", "refs/heads/main", true},
+		{"refs/heads/*", "refs/tags/v1.0", false},
+		{"refs/heads/*", "refs/heads/feature/x", false},
+		{"refs/heads/feature/*", "refs/heads/feature/x", true},
+		{"refs/tags/v[0-9]*", "refs/tags/v1.0", true},
+		{"refs/tags/v[0-9]*", "refs/tags/nightly", false},
+		{"[", "refs/heads/main", false},
+	}
+
+	for _, tt := range tests {
+		Config.RefGlob = tt.glob
+		if got := refIncluded(tt.refName); got != tt.expected {
+			t.Errorf("refIncluded(%q) with glob %q = %v, expected %v", tt.refName, tt.glob, got, tt.expected)
+		}
+	}
+}
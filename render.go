@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// renderPool runs page rendering jobs on a fixed number of goroutines
+// Jobs must not touch libgit2 objects: everything a page needs is resolved
+// on the submitting goroutine, and jobs only highlight, execute templates
+// and write files
+type renderPool struct {
+	jobs chan func() error
+	wg   sync.WaitGroup
+	once sync.Once
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// newRenderPool starts a pool of the given number of workers
+// Zero or less means one worker per CPU, and a single worker runs every
+// job inline on the submitting goroutine
+func newRenderPool(workers int) *renderPool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	p := &renderPool{}
+	if workers == 1 {
+		return p
+	}
+
+	p.jobs = make(chan func() error, workers)
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				p.record(job())
+			}
+		}()
+	}
+	return p
+}
+
+func (p *renderPool) record(err error) {
+	if err == nil {
+		return
+	}
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+}
+
+// Go submits a job, blocking while every worker is busy
+func (p *renderPool) Go(job func() error) {
+	if p.jobs == nil {
+		p.record(job())
+		return
+	}
+	p.jobs <- job
+}
+
+// Wait blocks until every submitted job has finished, stops the workers and
+// returns the errors of all failed jobs
+// It may be called more than once, so that it can also be deferred
+func (p *renderPool) Wait() error {
+	p.once.Do(func() {
+		if p.jobs != nil {
+			close(p.jobs)
+			p.wg.Wait()
+		}
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(p.errs...)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRenderPool(t *testing.T) {
+	for _, workers := range []int{0, 1, 4} {
+		pool := newRenderPool(workers)
+
+		var ran int64
+		for i := 0; i < 100; i++ {
+			pool.Go(func() error {
+				atomic.AddInt64(&ran, 1)
+				return nil
+			})
+		}
+		err := pool.Wait()
+		if err != nil {
+			t.Errorf("workers=%d: unexpected error: %v", workers, err)
+		}
+
+		if ran != 100 {
+			t.Errorf("workers=%d: expected 100 jobs to run, got %d", workers, ran)
+		}
+	}
+
+	t.Run("single worker runs jobs inline", func(t *testing.T) {
+		pool := newRenderPool(1)
+
+		ran := false
+		pool.Go(func() error {
+			ran = true
+			return nil
+		})
+		if !ran {
+			t.Error("expected job to have run before Go returned")
+		}
+		pool.Wait()
+	})
+
+	t.Run("returns errors of failed jobs", func(t *testing.T) {
+		pool := newRenderPool(4)
+		failure := errors.New("failed")
+
+		for i := 0; i < 10; i++ {
+			pool.Go(func() error {
+				if i == 3 {
+					return failure
+				}
+				return nil
+			})
+		}
+
+		err := pool.Wait()
+		if !errors.Is(err, failure) {
+			t.Errorf("expected error %v, got %v", failure, err)
+		}
+
+		// Wait can be called again, e.g. from a defer
+		if err := pool.Wait(); !errors.Is(err, failure) {
+			t.Errorf("expected error %v from second Wait, got %v", failure, err)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// defaultDescription is the description git init leaves in new repositories
+const defaultDescription = "Unnamed repository;"
+
+// isRepo reports whether dir is a git repository, either a working tree
+// with a .git directory or file, or a bare repository
+func isRepo(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// findRepos returns the repositories at paths: every path that is a
+// repository itself, followed by the repositories directly inside every
+// other path, in the order of their names
+func findRepos(paths []string) ([]string, error) {
+	var repos []string
+	for _, path := range paths {
+		if isRepo(path) {
+			repos = append(repos, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		for _, entry := range entries {
+			dir := filepath.Join(path, entry.Name())
+			if entry.IsDir() && isRepo(dir) {
+				found = append(found, dir)
+			}
+		}
+		sort.Strings(found)
+		repos = append(repos, found...)
+	}
+	return repos, nil
+}
+
+// readRepoFile returns the first line of the file name in the git directory
+// of repo, or nothing if it does not exist
+func readRepoFile(repo *git.Repository, name string) string {
+	data, err := os.ReadFile(filepath.Join(repo.Path(), name))
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line)
+}
+
+// newRepoListElem returns the entry of the site index for the repository at
+// repoPath, generated as name with commitCount commits on its current branch
+// The description and the owner are read from the description and owner
+// files of the git directory, as gitweb and stagit do, or from the
+// gitweb.description and gitweb.owner settings of its configuration
+func newRepoListElem(repoPath, name string, commitCount int) (RepoListElem, error) {
+	elem := RepoListElem{Name: name, Link: "/" + name + "/index.html", CommitCount: commitCount}
+
+	repo, err := git.OpenRepositoryExtended(repoPath, git.RepositoryOpenNoSearch, "")
+	if err != nil {
+		return elem, err
+	}
+	defer repo.Free()
+
+	elem.Description = readRepoFile(repo, "description")
+	if strings.HasPrefix(elem.Description, defaultDescription) {
+		elem.Description = ""
+	}
+	elem.Owner = readRepoFile(repo, "owner")
+	if config, err := repo.Config(); err == nil {
+		if elem.Description == "" {
+			elem.Description, _ = config.LookupString("gitweb.description")
+		}
+		if elem.Owner == "" {
+			elem.Owner, _ = config.LookupString("gitweb.owner")
+		}
+		config.Free()
+	}
+
+	obj, _, err := repo.RevparseExt("HEAD")
+	if err != nil {
+		return elem, nil
+	}
+	defer obj.Free()
+	if commit, err := obj.AsCommit(); err == nil {
+		elem.LastCommit = commit.Author().When
+		commit.Free()
+	}
+	return elem, nil
+}
+
+// writeSiteIndex writes the index of every repository of the site at the
+// root of destDir, along with the styles it uses
+func writeSiteIndex(destDir, installDir string, repos []RepoListElem) error {
+	err := makeDir(destDir)
+	if err != nil {
+		return err
+	}
+
+	tmplDir := templatesDir(installDir)
+	stylesCSS, err := readTemplateFile(tmplDir, "styles.css")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(destDir, "styles.css"), stylesCSS, 0644)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := loadTemplates(tmplDir)
+	if err != nil {
+		return err
+	}
+
+	indexfile, err := os.Create(filepath.Join(destDir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer indexfile.Close()
+
+	err = tmpl.ExecuteTemplate(indexfile, "repos.html", SiteIndexRenderData{
+		Repos:     repos,
+		LogoFound: GlobalDataGlobal.LogoFound,
+	})
+	if err != nil {
+		return err
+	}
+	return indexfile.Sync()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeFakeRepo creates the layout that isRepo looks for at dir
+func makeFakeRepo(t *testing.T, dir string, bare bool) {
+	t.Helper()
+	names := []string{".git"}
+	if bare {
+		names = []string{"objects", "refs"}
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+	}
+	if bare {
+		if err := os.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+			t.Fatalf("failed to write HEAD: %v", err)
+		}
+	}
+}
+
+func TestIsRepo(t *testing.T) {
+	tmpDir := t.TempDir()
+	worktree := filepath.Join(tmpDir, "worktree")
+	bare := filepath.Join(tmpDir, "bare.git")
+	plain := filepath.Join(tmpDir, "plain")
+	makeFakeRepo(t, worktree, false)
+	makeFakeRepo(t, bare, true)
+	if err := os.MkdirAll(filepath.Join(plain, "refs"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	tests := []struct {
+		dir      string
+		expected bool
+	}{
+		{worktree, true},
+		{bare, true},
+		{plain, false},
+		{filepath.Join(tmpDir, "missing"), false},
+	}
+
+	for _, tc := range tests {
+		if got := isRepo(tc.dir); got != tc.expected {
+			t.Errorf("isRepo(%s): expected %v, got %v", filepath.Base(tc.dir), tc.expected, got)
+		}
+	}
+}
+
+func TestFindRepos(t *testing.T) {
+	tmpDir := t.TempDir()
+	single := filepath.Join(tmpDir, "single")
+	makeFakeRepo(t, single, false)
+
+	scanned := filepath.Join(tmpDir, "srv")
+	makeFakeRepo(t, filepath.Join(scanned, "zeta.git"), true)
+	makeFakeRepo(t, filepath.Join(scanned, "alpha"), false)
+	if err := os.MkdirAll(filepath.Join(scanned, "notes"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(scanned, "README"), []byte("repos"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	repos, err := findRepos([]string{single, scanned})
+	if err != nil {
+		t.Fatalf("findRepos() failed: %v", err)
+	}
+	expected := []string{single, filepath.Join(scanned, "alpha"), filepath.Join(scanned, "zeta.git")}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Errorf("expected %v, got %v", expected, repos)
+	}
+
+	if _, err := findRepos([]string{filepath.Join(tmpDir, "missing")}); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestNewRepoListElem(t *testing.T) {
+	repo, repoPath := createTestRepo(t)
+	defer repo.Free()
+	createCommitInRepo(t, repo, repoPath, "file.txt", "content", "Initial commit")
+
+	gitDir := filepath.Join(repoPath, ".git")
+	err := os.WriteFile(filepath.Join(gitDir, "description"), []byte("A static git site generator\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write description: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(gitDir, "owner"), []byte("Jane Doe\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write owner: %v", err)
+	}
+
+	elem, err := newRepoListElem(repoPath, "gitgo", 1)
+	if err != nil {
+		t.Fatalf("newRepoListElem() failed: %v", err)
+	}
+	if elem.Link != "/gitgo/index.html" || elem.Description != "A static git site generator" || elem.Owner != "Jane Doe" || elem.CommitCount != 1 {
+		t.Errorf("unexpected entry %+v", elem)
+	}
+	if elem.LastCommit.IsZero() {
+		t.Error("expected the date of the last commit")
+	}
+
+	// the description git init leaves is no description
+	err = os.WriteFile(filepath.Join(gitDir, "description"), []byte("Unnamed repository; edit this file 'description' to name the repository.\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write description: %v", err)
+	}
+	elem, err = newRepoListElem(repoPath, "gitgo", 1)
+	if err != nil {
+		t.Fatalf("newRepoListElem() failed: %v", err)
+	}
+	if elem.Description != "" {
+		t.Errorf("expected no description, got %q", elem.Description)
+	}
+}
+
+func TestWriteSiteIndex(t *testing.T) {
+	installDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "build")
+	templatesDir := filepath.Join(installDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("failed to create templates dir: %v", err)
+	}
+	files := map[string]string{
+		"repos.html": `{{define "repos.html"}}{{range .Repos}}{{.Name}} {{.Link}} {{.Owner}} {{.CommitCount}}; {{end}}{{end}}`,
+		"styles.css": "body {}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	repos := []RepoListElem{
+		{Name: "alpha", Link: "/alpha/", Owner: "Jane", CommitCount: 3, LastCommit: time.Now()},
+		{Name: "zeta", Link: "/zeta/", CommitCount: 1},
+	}
+	err := writeSiteIndex(destDir, installDir, repos)
+	if err != nil {
+		t.Fatalf("writeSiteIndex() failed: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(destDir, "index.html"))
+	if err != nil {
+		t.Fatalf("expected the site index to be generated: %v", err)
+	}
+	if got, expected := string(contents), "alpha /alpha/ Jane 3; zeta /zeta/  1; "; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "styles.css")); err != nil {
+		t.Errorf("expected the styles to be copied: %v", err)
+	}
+}
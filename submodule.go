@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// Submodule is a submodule as declared in .gitmodules
+type Submodule struct {
+	Name string
+	Path string
+	URL  string
+}
+
+// parseGitmodules parses the contents of a .gitmodules file and returns the
+// declared submodules keyed by their path
+// Sections without a path are ignored
+func parseGitmodules(data []byte) map[string]Submodule {
+	submodules := make(map[string]Submodule)
+
+	var current *Submodule
+	flush := func() {
+		if current != nil && current.Path != "" {
+			submodules[current.Path] = *current
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			flush()
+			section := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			kind, name, _ := strings.Cut(section, " ")
+			if strings.EqualFold(kind, "submodule") {
+				current = &Submodule{Name: strings.Trim(strings.TrimSpace(name), `"`)}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			current.Path = strings.Trim(value, "/")
+		case "url":
+			current.URL = value
+		}
+	}
+	flush()
+
+	return submodules
+}
+
+// readGitmodules returns the submodules declared in the .gitmodules file of
+// tree, or an empty map when there is none
+func readGitmodules(repo *git.Repository, tree *git.Tree) map[string]Submodule {
+	entry := tree.EntryByName(".gitmodules")
+	if entry == nil || entry.Type != git.ObjectBlob {
+		return make(map[string]Submodule)
+	}
+
+	blob, err := repo.LookupBlob(entry.Id)
+	if err != nil {
+		GlobalWarnings.add(".gitmodules", err)
+		return make(map[string]Submodule)
+	}
+	defer blob.Free()
+
+	return parseGitmodules(blob.Contents())
+}
+
+// submoduleWebURL turns a clone URL into the URL of the repository's web
+// page, or returns an empty string for relative and local URLs
+// For example, both git@github.com:hltk/gitgo.git and
+// ssh://git@github.com/hltk/gitgo.git become https://github.com/hltk/gitgo
+func submoduleWebURL(cloneURL string) string {
+	if cloneURL == "" || strings.HasPrefix(cloneURL, ".") || strings.HasPrefix(cloneURL, "/") {
+		return ""
+	}
+
+	var host, repoPath string
+	if u, err := url.Parse(cloneURL); err == nil && u.Scheme != "" && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "ssh", "git", "git+ssh":
+		default:
+			return ""
+		}
+		host, repoPath = u.Hostname(), u.Path
+		if u.Scheme == "http" || u.Scheme == "https" {
+			host = u.Host
+		}
+	} else if userHost, p, found := strings.Cut(cloneURL, ":"); found && !strings.Contains(userHost, "/") && !strings.HasPrefix(p, "//") {
+		// scp-like syntax: [user@]host:path
+		if i := strings.LastIndex(userHost, "@"); i >= 0 {
+			userHost = userHost[i+1:]
+		}
+		host, repoPath = userHost, p
+	} else {
+		return ""
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if host == "" || repoPath == "" {
+		return ""
+	}
+	return "https://" + host + "/" + repoPath
+}
+
+// submoduleLink returns where the tree entry of sub pinned at commit links to
+// With Config.SubmoduleBaseUrl set, that is the commit page on the gitgo site
+// of the submodule, expected at <base>/<name>/; otherwise it is the web page
+// of the submodule's URL, which may be empty
+func submoduleLink(sub Submodule, commit string) string {
+	if Config.SubmoduleBaseUrl == "" {
+		return submoduleWebURL(sub.URL)
+	}
+
+	name := sub.URL
+	if name == "" {
+		name = sub.Path
+	}
+	name = strings.TrimSuffix(path.Base(strings.TrimRight(name, "/")), ".git")
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimRight(Config.SubmoduleBaseUrl, "/") + "/" + name + "/commit/" + commit + ".html"
+}
+
+// submoduleFileListElem returns the tree listing entry of the submodule
+// entry found at repoPath, which is relative to the tree root
+func submoduleFileListElem(entry *git.TreeEntry, repoPath string, submodules map[string]Submodule) FileListElem {
+	// without an entry in .gitmodules there is no URL to show or link to
+	sub, ok := submodules[repoPath]
+	if !ok {
+		sub = Submodule{Name: repoPath, Path: repoPath}
+	}
+
+	commit := entry.Id.String()
+	return FileListElem{
+		Name:            entry.Name,
+		Mode:            "m---------",
+		IsSubmodule:     true,
+		SubmoduleCommit: commit,
+		SubmoduleURL:    sub.URL,
+		SubmoduleLink:   submoduleLink(sub, commit),
+	}
+}
+
+// isSubmoduleDelta reports whether either side of delta is a submodule
+func isSubmoduleDelta(delta git.DiffDelta) bool {
+	return git.Filemode(delta.OldFile.Mode) == git.FilemodeCommit ||
+		git.Filemode(delta.NewFile.Mode) == git.FilemodeCommit
+}
+
+// submoduleDiff returns the diff text shown for a change to a submodule
+// pointer, in place of the patch libgit2 would produce for it
+func submoduleDiff(delta git.DiffDelta) string {
+	header := fmt.Sprintf("diff --git a/%s b/%s\n", delta.OldFile.Path, delta.NewFile.Path)
+
+	oldIsSubmodule := git.Filemode(delta.OldFile.Mode) == git.FilemodeCommit
+	newIsSubmodule := git.Filemode(delta.NewFile.Mode) == git.FilemodeCommit
+	switch {
+	case delta.Status == git.DeltaAdded || !oldIsSubmodule:
+		return header + "+Subproject commit " + delta.NewFile.Oid.String()
+	case delta.Status == git.DeltaDeleted || !newIsSubmodule:
+		return header + "-Subproject commit " + delta.OldFile.Oid.String()
+	default:
+		return header + "Subproject commit " + delta.OldFile.Oid.String() + " → " + delta.NewFile.Oid.String()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseGitmodules(t *testing.T) {
+	data := []byte(`# submodules
+[submodule "lib"]
+	path = lib
+	url = https://github.com/hltk/lib.git
+[core]
+	path = ignored
+[submodule "vendor/dep"]
+	path = "vendor/dep/"
+	; the url comes later
+	url = git@github.com:hltk/dep.git
+[submodule "nopath"]
+	url = https://example.com/nopath.git
+`)
+
+	submodules := parseGitmodules(data)
+
+	if len(submodules) != 2 {
+		t.Fatalf("expected 2 submodules, got %d: %v", len(submodules), submodules)
+	}
+
+	expected := map[string]Submodule{
+		"lib":        {Name: "lib", Path: "lib", URL: "https://github.com/hltk/lib.git"},
+		"vendor/dep": {Name: "vendor/dep", Path: "vendor/dep", URL: "git@github.com:hltk/dep.git"},
+	}
+	for path, want := range expected {
+		if got := submodules[path]; got != want {
+			t.Errorf("submodule %s: expected %+v, got %+v", path, want, got)
+		}
+	}
+}
+
+func TestSubmoduleWebURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://github.com/hltk/gitgo.git", "https://github.com/hltk/gitgo"},
+		{"https://git.example.com:8443/gitgo/", "https://git.example.com:8443/gitgo"},
+		{"git@github.com:hltk/gitgo.git", "https://github.com/hltk/gitgo"},
+		{"github.com:hltk/gitgo", "https://github.com/hltk/gitgo"},
+		{"ssh://git@github.com/hltk/gitgo.git", "https://github.com/hltk/gitgo"},
+		{"git://git.example.com/gitgo.git", "https://git.example.com/gitgo"},
+		{"../gitgo.git", ""},
+		{"/srv/git/gitgo.git", ""},
+		{"file:///srv/git/gitgo.git", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := submoduleWebURL(tt.url); got != tt.expected {
+			t.Errorf("submoduleWebURL(%q) = %q, expected %q", tt.url, got, tt.expected)
+		}
+	}
+}
+
+func TestSubmoduleLink(t *testing.T) {
+	origBaseUrl := Config.SubmoduleBaseUrl
+	defer func() { Config.SubmoduleBaseUrl = origBaseUrl }()
+
+	sub := Submodule{Name: "lib", Path: "third_party/lib", URL: "git@github.com:hltk/lib.git"}
+
+	Config.SubmoduleBaseUrl = ""
+	if got := submoduleLink(sub, "abc"); got != "https://github.com/hltk/lib" {
+		t.Errorf("expected link to the remote, got %q", got)
+	}
+
+	Config.SubmoduleBaseUrl = "https://git.example.com/"
+	if got := submoduleLink(sub, "abc"); got != "https://git.example.com/lib/commit/abc.html" {
+		t.Errorf("expected link to the gitgo site, got %q", got)
+	}
+
+	noURL := Submodule{Name: "lib", Path: "third_party/lib"}
+	if got := submoduleLink(noURL, "abc"); got != "https://git.example.com/lib/commit/abc.html" {
+		t.Errorf("expected link named after the path, got %q", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//go:embed templates/*.html templates/styles.css templates/js/main.js
+var embeddedTemplates embed.FS
+
+// defaultTemplates holds the templates and assets built into the binary, by
+// their path in the templates directory
+var defaultTemplates = mustSub(embeddedTemplates, "templates")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// templatesDir returns the directory whose files replace the built-in
+// templates and assets of the same name: Config.TemplatesDir, or the
+// templates directory of installDir
+func templatesDir(installDir string) string {
+	if Config.TemplatesDir != "" {
+		return Config.TemplatesDir
+	}
+	return filepath.Join(installDir, "templates")
+}
+
+// readTemplateFile returns the file at name, a slash-separated path in the
+// templates directory, from dir, or the built-in one if dir has none
+func readTemplateFile(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return fs.ReadFile(defaultTemplates, name)
+	}
+	return data, err
+}
+
+// templateNames returns the names of the built-in templates and of the
+// templates in dir, in order
+func templateNames(dir string) ([]string, error) {
+	names, err := fs.Glob(defaultTemplates, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, file := range overrides {
+		if name := filepath.Base(file); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// loadTemplates parses the built-in templates, then the templates in dir,
+// whose definitions replace the built-in ones of the same name
+func loadTemplates(dir string) (*template.Template, error) {
+	templ = template.New("").Funcs(funcmap)
+	_, err := templ.ParseFS(defaultTemplates, "*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(overrides) == 0 {
+		return templ, err
+	}
+	return templ.ParseFiles(overrides...)
+}
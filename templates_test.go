@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	t.Run("falls back to the built-in templates", func(t *testing.T) {
+		tmpl, err := loadTemplates(filepath.Join(t.TempDir(), "missing"))
+		if err != nil {
+			t.Fatalf("loadTemplates() failed: %v", err)
+		}
+		for _, name := range []string{"header.html", "footer.html", "index.html", "commit.html", "repos.html"} {
+			if tmpl.Lookup(name) == nil {
+				t.Errorf("expected the built-in %s", name)
+			}
+		}
+	})
+
+	t.Run("replaces single templates", func(t *testing.T) {
+		dir := t.TempDir()
+		footer := `{{define "footer.html"}}custom footer{{end}}`
+		if err := os.WriteFile(filepath.Join(dir, "footer.html"), []byte(footer), 0644); err != nil {
+			t.Fatalf("failed to write template: %v", err)
+		}
+
+		tmpl, err := loadTemplates(dir)
+		if err != nil {
+			t.Fatalf("loadTemplates() failed: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, "footer.html", nil); err != nil {
+			t.Fatalf("failed to execute footer.html: %v", err)
+		}
+		if buf.String() != "custom footer" {
+			t.Errorf("expected the replaced footer, got %q", buf.String())
+		}
+		if tmpl.Lookup("header.html") == nil {
+			t.Errorf("expected the built-in header next to the replaced footer")
+		}
+	})
+}
+
+func TestReadTemplateFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "styles.css"), []byte("body {}"), 0644); err != nil {
+		t.Fatalf("failed to write styles: %v", err)
+	}
+
+	styles, err := readTemplateFile(dir, "styles.css")
+	if err != nil {
+		t.Fatalf("readTemplateFile() failed: %v", err)
+	}
+	if string(styles) != "body {}" {
+		t.Errorf("expected the replaced styles, got %q", styles)
+	}
+
+	mainJS, err := readTemplateFile(dir, "js/main.js")
+	if err != nil {
+		t.Fatalf("readTemplateFile() failed: %v", err)
+	}
+	builtIn, err := os.ReadFile(filepath.Join("templates", "js", "main.js"))
+	if err != nil {
+		t.Fatalf("failed to read main.js: %v", err)
+	}
+	if !bytes.Equal(mainJS, builtIn) {
+		t.Errorf("expected the built-in main.js")
+	}
+
+	if _, err := readTemplateFile(dir, "missing.html"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestTemplateNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"footer.html", "extra.html", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	names, err := templateNames(dir)
+	if err != nil {
+		t.Fatalf("templateNames() failed: %v", err)
+	}
+	count := make(map[string]int)
+	for _, name := range names {
+		count[name]++
+	}
+	if count["footer.html"] != 1 || count["extra.html"] != 1 || count["header.html"] != 1 {
+		t.Errorf("expected the built-in and the extra templates once each, got %v", names)
+	}
+	if count["notes.txt"] != 0 {
+		t.Errorf("expected only templates, got %v", names)
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(names, sorted) {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+}
@@ -16,6 +16,23 @@ type CommitListElem struct {
 	Name       string
 	Date       time.Time
 	AbbrevHash string
+	Hash       string
+	Parents    []string
+	Graph      GraphRow // set on logs of all parents
+}
+
+// GraphRow is the row of the commit graph next to a commit in the log
+type GraphRow struct {
+	Column int // the lane of the commit
+	Width  int // the number of lanes the row spans
+	Lines  []GraphLine
+}
+
+// GraphLine connects lane From to lane To within a row of the commit graph
+type GraphLine struct {
+	Kind graphLineKind
+	From int
+	To   int
 }
 
 type FileListElem struct {
@@ -27,6 +44,11 @@ type FileListElem struct {
 	LastModified   time.Time
 	LastCommitMsg  string
 	LastCommitLink string
+	// set for submodules, which link to SubmoduleLink when it is not empty
+	IsSubmodule     bool
+	SubmoduleCommit string
+	SubmoduleURL    string
+	SubmoduleLink   string
 }
 
 type TreeItem struct {
@@ -68,8 +90,42 @@ type IndexRenderData struct {
 }
 
 type LogRenderData struct {
+	GlobalData  *GlobalRenderData
+	Commits     []CommitListElem
+	Path        string // set on the history page of a path
+	Title       string // set on archive pages
+	Pagination  Pagination
+	ArchiveLink string
+	Graph       bool // draw the commit graph next to the commits
+}
+
+// Pagination is the navigation between the pages of a log
+// Links to pages that do not exist are empty
+type Pagination struct {
+	Page      int
+	PageCount int
+	FirstLink string
+	PrevLink  string
+	NextLink  string
+	LastLink  string
+}
+
+type ArchiveMonth struct {
+	Name  string
+	Link  string
+	Count int
+}
+
+type ArchiveYear struct {
+	Year   int
+	Count  int
+	Months []ArchiveMonth
+}
+
+type ArchiveRenderData struct {
 	GlobalData *GlobalRenderData
-	Commits    []CommitListElem
+	LogLink    string
+	Years      []ArchiveYear
 }
 
 type TreeRenderData struct {
@@ -80,6 +136,7 @@ type TreeRenderData struct {
 	HasParent    bool
 	LatestCommit CommitListElem
 	CommitFound  bool
+	HistoryLink  string
 	FullTree     []FlatTreeItem
 }
 
@@ -90,8 +147,12 @@ type FileViewRenderData struct {
 	LastCommitLink   string
 	LastCommitDate   time.Time
 	LastCommitAuthor string
+	Permalink        string // the file in the tree of its last commit, if generated
+	BlameLink        string // the blame page of the file, if generated
+	HistoryLink      string // the history page of the file, if generated
 	RepoName         string
 	CurrentPath      string
+	Depth            int // the directories between the page and the root of the site
 }
 
 type FileRenderData struct {
@@ -101,23 +162,139 @@ type FileRenderData struct {
 	CurrentPath  string
 }
 
+// BlameGroup is a run of consecutive lines that the same commit last changed
+type BlameGroup struct {
+	Commit     string
+	AbbrevHash string
+	Link       string
+	Author     string
+	Date       time.Time
+	StartLine  int
+	Lines      []template.HTML
+}
+
+type BlameRenderData struct {
+	GlobalData  *GlobalRenderData
+	Name        string
+	FileLink    string
+	Groups      []BlameGroup
+	FullTree    []FlatTreeItem
+	CurrentPath string
+}
+
+// CommitParent is a parent of a commit, linked when it has a page
+type CommitParent struct {
+	Hash string
+	Link string
+}
+
 type CommitRenderData struct {
 	GlobalData    *GlobalRenderData
 	Id            string
 	Author        string
 	Mail          string
-	Parents       []string
+	Parents       []CommitParent
 	HasAnyParents bool
 	Date          time.Time
 	MsgLines      []string
-	DiffStatLines []template.HTML
+	Files         []DiffFile
+	Additions     int
+	Deletions     int
+	Split         bool   // the side by side view of the diff
+	TreeLink      string // the tree generated for the commit, if any
+	// the other view of the diff, if any
+	UnifiedLink string
+	SplitLink   string
+	// the commit as a patch email and as a plain diff
+	PatchLink string
+	DiffLink  string
+	// the number of files left out past the file limit
+	DroppedFiles int
+	// the commit page, on the page of a single collapsed file
+	CommitLink string
+	// of merges, the diffs against each parent and the commits brought in,
+	// of which at most maxMergedCommits are listed, linked when they have a
+	// page
+	ParentDiffs []ParentDiff
+	Merged      []CommitListElem
+	MergedCount int
+	Nav         CommitNav
+}
+
+// CommitNav is what a commit page shows of the commits and refs around it
+type CommitNav struct {
+	// the neighbours of the commit in the log, which lists the newest first
+	PrevLink    string
+	NextLink    string
+	ContainedIn []RefListElem
+	Describe    string // the commit named after its nearest tag
+}
+
+// ParentDiff links the diff of a merge against one of its parents
+type ParentDiff struct {
+	Number  int // counted from one
+	Hash    string
+	Link    string
+	Current bool
+}
+
+// DiffFile is a file changed by a commit, with its diff in both views
+type DiffFile struct {
+	Anchor     string
+	Status     string
+	OldPath    string
+	NewPath    string
+	Similarity int // of renamed and copied files, in percent
+	Binary     bool
+	OldSize    int // of binary files, in bytes
+	NewSize    int
+	OldImage   string // the links to both sides of images, if any
+	NewImage   string
+	Additions  int
+	Deletions  int
+	Collapsed  string // why the diff is not shown, if it is not
+	Link       string // the page of the collapsed diff, if any
+	// the widths of the bars of the summary, in percent
+	AddBar int
+	DelBar int
+	// the unified view
+	Lines []template.HTML
+	// the side by side view
+	Header []string
+	Hunks  []SplitDiffHunk
+}
+
+type SplitDiffCell struct {
+	Line    int // zero for no line number
+	Content template.HTML
+	Class   string
+}
+
+type SplitDiffRow struct {
+	Old SplitDiffCell
+	New SplitDiffCell
+}
+
+type SplitDiffHunk struct {
+	Header string
+	Rows   []SplitDiffRow
 }
 
 type RefListElem struct {
 	Name       string
+	RefName    string // full name, such as "refs/heads/main"
 	Type       string // "branch" or "tag"
 	CommitHash string
-	LogLink    string
+	Target     string // full ID of the commit the ref points to
+	// LogLink and TreeLink are empty for refs without generated pages
+	LogLink  string
+	TreeLink string
+}
+
+// RedirectRenderData is a page that sends the browser on to Link
+type RedirectRenderData struct {
+	GlobalData *GlobalRenderData
+	Link       string
 }
 
 type RefsRenderData struct {
@@ -125,3 +302,18 @@ type RefsRenderData struct {
 	Branches   []RefListElem
 	Tags       []RefListElem
 }
+
+// RepoListElem is a repository on the index of the site
+type RepoListElem struct {
+	Name        string
+	Link        string
+	Description string
+	Owner       string
+	LastCommit  time.Time
+	CommitCount int
+}
+
+type SiteIndexRenderData struct {
+	Repos     []RepoListElem
+	LogoFound bool
+}
@@ -135,11 +135,8 @@ func highlightFileContents(filename string, contents []byte) []template.HTML {
 	// Use HTML formatter with classes (not inline styles)
 	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(false), chromahtml.PreventSurroundingPre(true))
 
-	// Get the style (we'll use github style, CSS will be generated separately)
-	style := styles.Get("github")
-	if style == nil {
-		style = styles.Fallback
-	}
+	// Get the style (CSS will be generated separately)
+	style := highlightStyle()
 
 	// Tokenize the code
 	iterator, err := lexer.Tokenise(nil, string(contents))
@@ -206,13 +203,20 @@ func contentsToLinesHTML(contents []byte, size int) []template.HTML {
 	return result
 }
 
-// generateChromaCSS generates the CSS stylesheet for syntax highlighting
-// Returns the CSS as a string
-func generateChromaCSS() (string, error) {
-	style := styles.Get("github")
+// highlightStyle returns the chroma style named by Config.HighlightStyle, or
+// the fallback style for unknown names
+func highlightStyle() *chroma.Style {
+	style := styles.Get(Config.HighlightStyle)
 	if style == nil {
 		style = styles.Fallback
 	}
+	return style
+}
+
+// generateChromaCSS generates the CSS stylesheet for syntax highlighting
+// Returns the CSS as a string
+func generateChromaCSS() (string, error) {
+	style := highlightStyle()
 
 	formatter := chromahtml.New(chromahtml.WithClasses(true))
 
@@ -233,6 +237,13 @@ func generateChromaCSS() (string, error) {
 	background-color: #ffeef0;
 	color: #24292e;
 }
+/* Changed words within a modified line */
+.diff-add .diff-word {
+	background-color: #acf2bd;
+}
+.diff-del .diff-word {
+	background-color: #fdb8c0;
+}
 `
 
 	return buf.String() + customCSS, nil
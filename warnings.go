@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Warning is a problem that did not stop the build, such as an unreadable
+// image or a template that failed on one page
+type Warning struct {
+	// Page is the path of the affected output, relative to the destination directory
+	Page string
+	Err  error
+}
+
+func (w Warning) String() string {
+	if w.Page == "" {
+		return w.Err.Error()
+	}
+	return w.Page + ": " + w.Err.Error()
+}
+
+// warningList collects the warnings of one build; render jobs add to it
+// concurrently
+type warningList struct {
+	mu    sync.Mutex
+	items []Warning
+}
+
+func (l *warningList) add(page string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = append(l.items, Warning{Page: page, Err: err})
+}
+
+func (l *warningList) list() []Warning {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Warning(nil), l.items...)
+}
+
+// printWarnings writes a summary of warnings to w
+func printWarnings(w io.Writer, warnings []Warning) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%d warning(s):\n", len(warnings))
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "  %s\n", warning)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWarningList(t *testing.T) {
+	t.Run("collects warnings concurrently", func(t *testing.T) {
+		warnings := &warningList{}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				warnings.add("tree/index.html", errors.New("template failed"))
+			}()
+		}
+		wg.Wait()
+
+		if len(warnings.list()) != 50 {
+			t.Errorf("expected 50 warnings, got %d", len(warnings.list()))
+		}
+	})
+
+	t.Run("formats warnings with their page", func(t *testing.T) {
+		w := Warning{Page: "tree/a.png.html", Err: errors.New("unreadable image")}
+		if w.String() != "tree/a.png.html: unreadable image" {
+			t.Errorf("unexpected warning string %q", w.String())
+		}
+
+		w = Warning{Err: errors.New("iterating tags")}
+		if w.String() != "iterating tags" {
+			t.Errorf("unexpected warning string %q", w.String())
+		}
+	})
+}
+
+func TestPrintWarnings(t *testing.T) {
+	t.Run("prints nothing without warnings", func(t *testing.T) {
+		var buf bytes.Buffer
+		printWarnings(&buf, nil)
+		if buf.Len() != 0 {
+			t.Errorf("expected no output, got %q", buf.String())
+		}
+	})
+
+	t.Run("prints a summary", func(t *testing.T) {
+		var buf bytes.Buffer
+		printWarnings(&buf, []Warning{
+			{Page: "commit/abc.html", Err: errors.New("template failed")},
+			{Page: "assets/logo.png", Err: errors.New("unreadable image")},
+		})
+
+		out := buf.String()
+		if !strings.HasPrefix(out, "2 warning(s):") {
+			t.Errorf("expected summary header, got %q", out)
+		}
+		if !strings.Contains(out, "commit/abc.html: template failed") {
+			t.Errorf("expected first warning in output, got %q", out)
+		}
+	})
+}